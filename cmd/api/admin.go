@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+func (app *application) getUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r.Context())
+
+	roles, err := app.store.Roles.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) assignUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r.Context())
+
+	role := chi.URLParam(r, "role")
+	if !slices.Contains(iauth.Roles, role) {
+		app.badRequest(w, r, store.ErrUnknownRole)
+		return
+	}
+
+	if err := app.store.Roles.Assign(r.Context(), user.ID, role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) revokeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r.Context())
+
+	role := chi.URLParam(r, "role")
+	if !slices.Contains(iauth.Roles, role) {
+		app.badRequest(w, r, store.ErrUnknownRole)
+		return
+	}
+
+	if err := app.store.Roles.Revoke(r.Context(), user.ID, role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -11,7 +11,10 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/yusuf-cirak/social/internal/audit"
 	"github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/blob"
+	"github.com/yusuf-cirak/social/internal/mailer"
 	"github.com/yusuf-cirak/social/internal/ratelimiter"
 	"github.com/yusuf-cirak/social/internal/store"
 	"go.uber.org/zap"
@@ -22,15 +25,54 @@ type application struct {
 	store       store.Storage
 	logger      *zap.SugaredLogger // zap.Logger is much faster but only does structured logging.
 	jwt         *auth.Manager
-	policy      *auth.PolicyEngine
+	policy      auth.Authorizer
 	rateLimiter *ratelimiter.FixedWindowRateLimiter
+	revocations auth.RevocationList
+	mailer      mailer.Client
+	audit       audit.Sink
+	secrets     *auth.SecretBox
+	oidc        auth.OIDCProviders
+	blobs       blob.Store
 }
 
 type config struct {
-	addr string
-	db   dbConfig
-	env  string
-	auth authConfig
+	addr        string
+	db          dbConfig
+	env         string
+	auth        authConfig
+	mail        mailConfig
+	comments    commentsConfig
+	posts       postsConfig
+	media       mediaConfig
+	frontendURL string
+}
+
+type mediaConfig struct {
+	// maxUploadBytes is the largest file that can be uploaded.
+	maxUploadBytes int64
+	// blobBackend is where uploads are stored: "fs" for blobDir on the local
+	// filesystem or "s3" for the bucket described by s3.
+	blobBackend string
+	blobDir     string
+	s3          blob.S3Config
+}
+
+type postsConfig struct {
+	// trashRetention is how long deleted posts can be restored before the
+	// purge job removes them.
+	trashRetention time.Duration
+}
+
+type commentsConfig struct {
+	// maxDepth caps how many levels of replies a comment listing returns.
+	maxDepth int
+}
+
+type mailConfig struct {
+	dir              string
+	fromEmail        string
+	invitationExp    time.Duration
+	passwordResetExp time.Duration
 }
 
 type dbConfig struct {
@@ -52,12 +94,27 @@ func (app *application) mount() *chi.Mux {
 
 	r.Use(app.RateLimiterMiddleware)
 
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	r.Route("/v1", func(r chi.Router) {
 
 		r.Get("/health", app.healthCheckHandler)
 
 		// auth endpoints
+		r.Post("/auth/register", app.registerUserHandler)
 		r.Post("/auth/login", app.loginHandler)
+		r.Post("/auth/refresh", app.refreshTokenHandler)
+		r.Post("/auth/password/forgot", app.forgotPasswordHandler)
+		r.Post("/auth/password/reset", app.resetPasswordHandler)
+		r.Post("/auth/mfa/verify", app.verifyMFALoginHandler)
+		r.Get("/auth/oidc/{provider}", app.oidcLoginHandler)
+		r.Get("/auth/oidc/{provider}/callback", app.oidcCallbackHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(app.authMiddleware)
+			r.Use(app.requireSession)
+			r.Post("/auth/logout", app.logoutHandler)
+		})
 
 		r.Route("/posts", func(r chi.Router) {
 			// Protected routes with authorization
@@ -66,7 +123,26 @@ func (app *application) mount() *chi.Mux {
 				r.Use(app.authorize(auth.ActionPostCreate, app.resourcePostCreate))
 				r.Post("/", app.createPostHandler)
 			})
+
+			// Deleted posts
+			r.Route("/trash", func(r chi.Router) {
+				r.Use(app.authMiddleware)
+
+				// The current user's deleted posts
+				r.Group(func(r chi.Router) {
+					r.Use(app.requireScope(auth.ScopePostsWrite))
+					r.Get("/", app.getTrashHandler)
+				})
+
+				// Restore post - requires auth + having deleted it, or moderation
+				r.Group(func(r chi.Router) {
+					r.Use(app.trashedPostContextMiddleware)
+					r.Use(app.authorize(auth.ActionPostRestore, app.resourceTrashedPostFromCtx))
+					r.Post("/{postID}/restore", app.restorePostHandler)
+				})
+			})
 			r.Route("/{postID}", func(r chi.Router) {
+				r.Use(app.optionalAuth)
 				r.Use(app.postsContextMiddleware)
 
 				r.Get("/", app.getPostHandler)
@@ -84,32 +160,222 @@ func (app *application) mount() *chi.Mux {
 					r.Use(app.authorize(auth.ActionPostUpdate, app.resourcePostFromCtx))
 					r.Patch("/", app.updatePostHandler)
 				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.authMiddleware)
+					r.Use(app.authorize(auth.ActionPostRepost, app.resourcePostFromCtx))
+					r.Put("/repost", app.repostHandler)
+					r.Delete("/repost", app.undoRepostHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(app.authMiddleware)
+					r.Use(app.authorize(auth.ActionPostReact, app.resourcePostFromCtx))
+					r.Put("/reactions/{kind}", app.putPostReactionHandler)
+					r.Delete("/reactions/{kind}", app.deletePostReactionHandler)
+				})
+
+				r.Route("/revisions", func(r chi.Router) {
+					r.Get("/", app.getRevisionsHandler)
+					r.Get("/diff", app.getRevisionDiffHandler)
+
+					// Restoring is an edit - requires auth + ownership
+					r.Group(func(r chi.Router) {
+						r.Use(app.authMiddleware)
+						r.Use(app.authorize(auth.ActionPostUpdate, app.resourcePostFromCtx))
+						r.Post("/{version}/restore", app.restoreRevisionHandler)
+					})
+				})
+
+				r.Route("/comments", func(r chi.Router) {
+					r.Get("/", app.getCommentsHandler)
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.authMiddleware)
+						r.Use(app.authorize(auth.ActionCommentCreate, app.resourceCommentCreate))
+						r.Post("/", app.createCommentHandler)
+					})
+				})
 			})
 		})
 
-		r.Route("/users", func(r chi.Router) {
-			r.Use(app.userContextMiddleware)
-			r.Get("/", app.getUserHandler)
+		r.Route("/comments/{commentID}", func(r chi.Router) {
+			r.Use(app.optionalAuth)
+			r.Use(app.commentsContextMiddleware)
+
+			r.Get("/replies", app.getRepliesHandler)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.authMiddleware)
+				r.Use(app.authorize(auth.ActionCommentReact, app.resourceCommentFromCtx))
+				r.Put("/reactions/{kind}", app.putCommentReactionHandler)
+				r.Delete("/reactions/{kind}", app.deleteCommentReactionHandler)
+			})
 
-			// Follow user - requires auth + policy check
+			// Update comment - requires auth + authorship
 			r.Group(func(r chi.Router) {
 				r.Use(app.authMiddleware)
-				r.Use(app.authorize(auth.ActionUserFollow, app.resourceUserFromCtx))
-				r.Put("/{userID}/follow", app.followUserHandler)
+				r.Use(app.authorize(auth.ActionCommentUpdate, app.resourceCommentFromCtx))
+				r.Patch("/", app.updateCommentHandler)
 			})
 
-			// Unfollow user - requires auth + policy check
+			// Delete comment - requires auth + authorship or owning the post
 			r.Group(func(r chi.Router) {
 				r.Use(app.authMiddleware)
-				r.Use(app.authorize(auth.ActionUserUnfollow, app.resourceUserFromCtx))
-				r.Delete("/{userID}/unfollow", app.unFollowUserHandler)
+				r.Use(app.authorize(auth.ActionCommentDelete, app.resourceCommentFromCtx))
+				r.Delete("/", app.deleteCommentHandler)
+			})
+		})
+
+		r.Route("/media", func(r chi.Router) {
+			// Uploading media is part of writing a post
+			r.Group(func(r chi.Router) {
+				r.Use(app.authMiddleware)
+				r.Use(app.authorize(auth.ActionPostCreate, app.resourcePostCreate))
+				r.Post("/", app.uploadMediaHandler)
+			})
+
+			r.Route("/{mediaID}", func(r chi.Router) {
+				r.Use(app.optionalAuth)
+				r.Use(app.mediaContextMiddleware)
+
+				r.Get("/", app.getMediaHandler)
+				r.Get("/content", app.getMediaContentHandler)
+				r.Get("/thumbnail", app.getMediaThumbnailHandler)
+			})
+		})
+
+		r.Route("/users", func(r chi.Router) {
+			r.Put("/activate/{token}", app.activateUserHandler)
+
+			// Account management requires a login session, not a personal access token
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.authMiddleware)
+				r.Use(app.requireSession)
+				r.Put("/password", app.changePasswordHandler)
+
+				// Drafts and scheduled posts only show up here
+				r.Get("/posts", app.getUnpublishedPostsHandler)
+
+				r.Route("/mfa/totp", func(r chi.Router) {
+					r.Post("/", app.enrollTOTPHandler)
+					r.Post("/verify", app.enableTOTPHandler)
+					r.Delete("/", app.disableTOTPHandler)
+				})
+
+				r.Route("/sessions", func(r chi.Router) {
+					r.Get("/", app.getSessionsHandler)
+					r.Delete("/{sessionID}", app.deleteSessionHandler)
+				})
+
+				r.Route("/bookmarks", func(r chi.Router) {
+					r.Group(func(r chi.Router) {
+						r.Use(app.authorize(auth.ActionBookmarkRead, app.resourceOwnBookmarks))
+						r.Get("/", app.getBookmarksHandler)
+						r.Get("/collections", app.getBookmarkCollectionsHandler)
+					})
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.authorize(auth.ActionBookmarkWrite, app.resourceOwnBookmarks))
+						r.Post("/", app.createBookmarkHandler)
+						r.Post("/collections", app.createBookmarkCollectionHandler)
+					})
+
+					r.Route("/collections/{collectionID}", func(r chi.Router) {
+						r.Use(app.bookmarkCollectionContextMiddleware)
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.authorize(auth.ActionBookmarkRead, app.resourceBookmarkCollectionFromCtx))
+							r.Get("/", app.getBookmarkCollectionHandler)
+						})
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.authorize(auth.ActionBookmarkWrite, app.resourceBookmarkCollectionFromCtx))
+							r.Patch("/", app.updateBookmarkCollectionHandler)
+							r.Delete("/", app.deleteBookmarkCollectionHandler)
+						})
+					})
+
+					r.Route("/{bookmarkID}", func(r chi.Router) {
+						r.Use(app.bookmarkContextMiddleware)
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.authorize(auth.ActionBookmarkRead, app.resourceBookmarkFromCtx))
+							r.Get("/", app.getBookmarkHandler)
+						})
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.authorize(auth.ActionBookmarkWrite, app.resourceBookmarkFromCtx))
+							r.Patch("/", app.updateBookmarkHandler)
+							r.Delete("/", app.deleteBookmarkHandler)
+						})
+					})
+				})
+
+				r.Route("/notifications", func(r chi.Router) {
+					r.Get("/", app.getNotificationsHandler)
+					r.Post("/read", app.readNotificationsHandler)
+				})
+
+				r.Route("/blocks", func(r chi.Router) {
+					r.Get("/", app.getBlocksHandler)
+					r.Put("/{userID}", app.blockUserHandler)
+					r.Delete("/{userID}", app.unblockUserHandler)
+				})
+
+				r.Route("/tokens", func(r chi.Router) {
+					r.Get("/", app.getPersonalAccessTokensHandler)
+					r.Post("/", app.createPersonalAccessTokenHandler)
+					r.Delete("/{tokenID}", app.deletePersonalAccessTokenHandler)
+				})
+			})
+
+			r.Route("/{userID}", func(r chi.Router) {
+				r.Use(app.userContextMiddleware)
+				r.Get("/", app.getUserHandler)
+
+				// Follow user - requires auth + policy check
+				r.Group(func(r chi.Router) {
+					r.Use(app.authMiddleware)
+					r.Use(app.authorize(auth.ActionUserFollow, app.resourceUserFromCtx))
+					r.Put("/follow", app.followUserHandler)
+				})
+
+				// Unfollow user - requires auth + policy check
+				r.Group(func(r chi.Router) {
+					r.Use(app.authMiddleware)
+					r.Use(app.authorize(auth.ActionUserUnfollow, app.resourceUserFromCtx))
+					r.Delete("/unfollow", app.unFollowUserHandler)
+				})
 			})
 		})
 
 		r.Group(func(r chi.Router) {
 			r.Use(app.authMiddleware)
+			r.Use(app.requireScope(auth.ScopeFeedRead))
 			r.Get("/feed", app.getUserFeedHandler)
 		})
+
+		// Admin endpoints - only admins pass the policy checks
+		r.Route("/admin/users/{userID}", func(r chi.Router) {
+			r.Use(app.authMiddleware)
+			r.Use(app.userContextMiddleware)
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.authorize(auth.ActionRoleRead, app.resourceUserFromCtx))
+				r.Get("/roles", app.getUserRolesHandler)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.authorize(auth.ActionRoleAssign, app.resourceUserFromCtx))
+				r.Put("/roles/{role}", app.assignUserRoleHandler)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(app.authorize(auth.ActionRoleRevoke, app.resourceUserFromCtx))
+				r.Delete("/roles/{role}", app.revokeUserRoleHandler)
+			})
+		})
 	})
 
 	return r
@@ -125,6 +391,11 @@ func (app *application) run(mux *chi.Mux) error {
 		IdleTimeout:  time.Second * 60,
 	}
 
+	// Background jobs run until the server starts shutting down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	waitForJobs := app.startBackgroundJobs(jobsCtx)
+
 	// Create a channel to receive the shutdown operation result
 	// This channel notifies the main goroutine whether graceful shutdown was successful or failed
 	shutDown := make(chan error)
@@ -147,11 +418,18 @@ func (app *application) run(mux *chi.Mux) error {
 
 		app.logger.Infow("signal caught", "signal", s.String())
 
+		stopJobs()
+
 		// CRITICAL: Send the result of srv.Shutdown(ctx) to the shutDown channel
 		// srv.Shutdown() attempts to gracefully close active connections
 		// Returns nil if successful, error if failed
 		// We send this result to the channel to notify the main goroutine
-		shutDown <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+
+		// Let jobs finish what they are doing, such as a batch of posts being published
+		waitForJobs()
+
+		shutDown <- err
 	}()
 
 	app.logger.Infow("Starting server", "address", app.config.addr, "environment", app.config.env)
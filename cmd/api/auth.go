@@ -3,70 +3,428 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/yusuf-cirak/social/internal/audit"
 	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/mailer"
 	"github.com/yusuf-cirak/social/internal/store"
+	"go.uber.org/zap"
 )
 
 type authConfig struct {
-	Secret         string
-	Issuer         string
-	Audience       string
-	AccessTokenTTL time.Duration
+	Secret          string
+	Issuer          string
+	Audience        string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// RevocationBackend selects where revoked access tokens are tracked: "postgres" or "memory".
+	RevocationBackend string
+	// SigningKeys lists PEM key files as comma separated kid=path pairs. When
+	// empty, tokens are signed with the HMAC Secret.
+	SigningKeys string
+	// ActiveKeyID is the kid new tokens are signed with; the other keys only verify.
+	ActiveKeyID string
+	// PolicyFile is an optional YAML/JSON policy replacing the built-in rules.
+	PolicyFile string
+	// AuditSinks lists where authorization decisions are recorded: "zap", "postgres" or both.
+	AuditSinks string
+	// MFAEncryptionKey encrypts TOTP secrets at rest.
+	MFAEncryptionKey string
+	// MFAPendingTTL is how long a login may wait for its second factor.
+	MFAPendingTTL time.Duration
+	// AccountLockout and IPLockout throttle failed logins per account and per client IP.
+	AccountLockout iauth.LockoutPolicy
+	IPLockout      iauth.LockoutPolicy
+	// OIDCProvidersFile is an optional YAML/JSON list of OpenID Connect identity providers.
+	OIDCProvidersFile string
+}
+
+// newAuditSink builds the audit sink from the comma separated list of sink names.
+func newAuditSink(names string, logger *zap.SugaredLogger, st store.Storage) (audit.Sink, error) {
+	var sinks audit.MultiSink
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "zap":
+			sinks = append(sinks, audit.NewZapSink(logger))
+		case "postgres":
+			sinks = append(sinks, st.AuditLog)
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q", name)
+		}
+	}
+	return sinks, nil
+}
+
+// newJWTManager builds the token manager from the auth configuration.
+func newJWTManager(cfg authConfig) (*iauth.Manager, error) {
+	if cfg.SigningKeys == "" {
+		return iauth.NewManager(cfg.Secret, cfg.Issuer, cfg.Audience), nil
+	}
+
+	keys := iauth.NewKeyring()
+	for _, entry := range strings.Split(cfg.SigningKeys, ",") {
+		kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid signing key entry %q, expected kid=path", entry)
+		}
+
+		key, err := iauth.LoadKeyFile(kid, path)
+		if err != nil {
+			return nil, fmt.Errorf("load signing key %q: %w", kid, err)
+		}
+		keys.Add(key)
+	}
+
+	if err := keys.SetActive(cfg.ActiveKeyID); err != nil {
+		return nil, fmt.Errorf("activate signing key %q: %w", cfg.ActiveKeyID, err)
+	}
+
+	return iauth.NewManagerWithKeyring(keys, cfg.Issuer, cfg.Audience), nil
+}
+
+// jwksHandler publishes the public signing keys so other services can verify our tokens.
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	set := iauth.JWKS{Keys: []iauth.JWK{}}
+	if app.jwt.Keys != nil {
+		set = app.jwt.Keys.JWKS()
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, set); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 type currentUserKey string
 
-const currentUserCtxKey currentUserKey = "current_user"
+const (
+	currentUserCtxKey   currentUserKey = "current_user"
+	currentClaimsCtxKey currentUserKey = "current_claims"
+	currentPATCtxKey    currentUserKey = "current_pat"
+)
+
+// authFailure is why the credentials of a request were refused, as the
+// status and message to respond with.
+type authFailure struct {
+	status  int
+	message string
+}
+
+func (f *authFailure) Error() string {
+	return f.message
+}
+
+var (
+	errMissingAuthHeader = &authFailure{http.StatusUnauthorized, "missing authorization header"}
+	errInvalidAuthHeader = &authFailure{http.StatusUnauthorized, "invalid authorization header"}
+	errInvalidToken      = &authFailure{http.StatusUnauthorized, "invalid or expired token"}
+	errUserNotFound      = &authFailure{http.StatusUnauthorized, "user not found"}
+	errAccountInactive   = &authFailure{http.StatusForbidden, "account is not activated"}
+)
 
 // authMiddleware validates the bearer token and loads the current user into context.
 func (app *application) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("Authorization")
-		if header == "" {
-			writeJSONError(w, http.StatusUnauthorized, "missing authorization header")
+		// Already authenticated by optionalAuth further up the route
+		if getCurrentUser(r.Context()) != nil {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		parts := strings.SplitN(header, " ", 2)
-		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			writeJSONError(w, http.StatusUnauthorized, "invalid authorization header")
+		ctx, err := app.authenticate(r)
+		if err != nil {
+			var failure *authFailure
+			switch {
+			case errors.As(err, &failure):
+				writeJSONError(w, failure.status, failure.message)
+			default:
+				app.internalServerError(w, r, err)
+			}
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		token := parts[1]
-		claims, err := app.jwt.ParseAndValidate(token)
-		if err != nil {
-			writeJSONError(w, http.StatusUnauthorized, "invalid or expired token")
+// authenticate checks the bearer token of a request and returns its context
+// with the current user, and the claims or personal access token it was
+// authenticated with. Refused credentials are reported as an *authFailure.
+func (app *application) authenticate(r *http.Request) (context.Context, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, errMissingAuthHeader
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return nil, errInvalidAuthHeader
+	}
+
+	token := parts[1]
+	if strings.HasPrefix(token, iauth.PersonalAccessTokenPrefix) {
+		return app.authenticatePersonalAccessToken(r, token)
+	}
+
+	claims, err := app.jwt.ParseAndValidate(token)
+	if err != nil || claims.ID == "" || !claims.IsAccessToken() {
+		return nil, errInvalidToken
+	}
+
+	revoked, err := app.revocations.IsRevoked(r.Context(), claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errInvalidToken
+	}
+
+	// Optionally load user from DB to ensure it still exists
+	user, err := app.store.Users.GetByID(r.Context(), claims.UserID)
+	if err != nil {
+		return nil, errUserNotFound
+	}
+
+	if !user.IsActive {
+		return nil, errAccountInactive
+	}
+
+	// Tokens issued before the last password change are no longer valid
+	if user.PasswordChangedAt != nil && (claims.IssuedAt == nil || claims.IssuedAt.Before(user.PasswordChangedAt.Truncate(time.Second))) {
+		return nil, errInvalidToken
+	}
+
+	if claims.SessionID != "" {
+		if err := app.checkSession(r, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), currentUserCtxKey, user)
+	ctx = context.WithValue(ctx, currentClaimsCtxKey, claims)
+	return ctx, nil
+}
+
+// checkSession rejects tokens whose session was terminated and otherwise
+// records that the session was seen.
+func (app *application) checkSession(r *http.Request, claims *iauth.Claims) error {
+	session, err := app.store.Sessions.GetByID(r.Context(), claims.SessionID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return errInvalidToken
+	case err != nil:
+		return err
+	case session.RevokedAt != nil || session.UserID != claims.UserID:
+		return errInvalidToken
+	}
+
+	// Last-seen only needs to be roughly right; don't write on every request
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		if err := app.store.Sessions.Touch(r.Context(), session.ID, clientIP(r)); err != nil {
+			app.logger.Errorw("Failed to update session", "session_id", session.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func getCurrentUser(ctx context.Context) *store.User {
+	user, ok := ctx.Value(currentUserCtxKey).(*store.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// optionalAuth authenticates requests that carry an Authorization header and
+// lets anonymous ones through without a current user. Requests whose
+// credentials are refused, such as an expired token, are served as anonymous
+// too; routes that need a user still reject them through authMiddleware.
+func (app *application) optionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		// Optionally load user from DB to ensure it still exists
-		user, err := app.store.Users.GetByID(r.Context(), claims.UserID)
+		ctx, err := app.authenticate(r)
 		if err != nil {
-			writeJSONError(w, http.StatusUnauthorized, "user not found")
+			var failure *authFailure
+			if !errors.As(err, &failure) {
+				app.internalServerError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
 			return
 		}
-
-		ctx := context.WithValue(r.Context(), currentUserCtxKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func getCurrentUser(ctx context.Context) *store.User {
-	user, ok := ctx.Value(currentUserCtxKey).(*store.User)
+// authenticatePersonalAccessToken authenticates a request made with a personal
+// access token instead of a JWT.
+func (app *application) authenticatePersonalAccessToken(r *http.Request, token string) (context.Context, error) {
+	ctx := r.Context()
+
+	pat, err := app.store.PersonalAccessTokens.GetByHash(ctx, iauth.HashOpaqueToken(token))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return nil, errInvalidToken
+		default:
+			return nil, err
+		}
+	}
+
+	if pat.ExpiresAt != nil && time.Now().After(*pat.ExpiresAt) {
+		return nil, errInvalidToken
+	}
+
+	user, err := app.store.Users.GetByID(ctx, pat.UserID)
+	if err != nil {
+		return nil, errUserNotFound
+	}
+
+	if !user.IsActive {
+		return nil, errAccountInactive
+	}
+
+	if err := app.store.PersonalAccessTokens.TouchLastUsed(ctx, pat.ID); err != nil {
+		app.logger.Warnw("Failed to update token last used time", "token_id", pat.ID, "error", err)
+	}
+
+	ctx = context.WithValue(ctx, currentUserCtxKey, user)
+	ctx = context.WithValue(ctx, currentPATCtxKey, pat)
+	return ctx, nil
+}
+
+// requireSession rejects requests authenticated with a personal access token.
+// It guards endpoints that manage the account itself.
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getCurrentClaims(r.Context()) == nil {
+			writeJSONError(w, http.StatusForbidden, "this endpoint requires a login session")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope rejects personal access tokens without the given scope. Requests
+// authenticated with a JWT are not restricted.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pat := getCurrentPAT(r.Context()); pat != nil && !pat.HasScope(scope) {
+				writeJSONError(w, http.StatusForbidden, "insufficient scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func getCurrentPAT(ctx context.Context) *store.PersonalAccessToken {
+	pat, ok := ctx.Value(currentPATCtxKey).(*store.PersonalAccessToken)
 	if !ok {
 		return nil
 	}
-	return user
+	return pat
+}
+
+func getCurrentClaims(ctx context.Context) *iauth.Claims {
+	claims, ok := ctx.Value(currentClaimsCtxKey).(*iauth.Claims)
+	if !ok {
+		return nil
+	}
+	return claims
+}
+
+type RegisterUserPayload struct {
+	// Username is letters, digits and underscores, so that it can be @mentioned.
+	Username string `json:"username" validate:"required,username"`
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+}
+
+// registerUserHandler creates an inactive user account with a bcrypt-hashed
+// password and emails an activation link.
+func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RegisterUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := &store.User{
+		Username: payload.Username,
+		Email:    payload.Email,
+	}
+
+	if err := user.Password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	token, hash, err := iauth.NewOpaqueToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Users.CreateAndInvite(ctx, user, hash, app.config.mail.invitationExp); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateEmail), errors.Is(err, store.ErrDuplicateUsername):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	msg, err := mailer.Render(mailer.UserWelcomeTemplate, user.Email, struct {
+		Username      string
+		ActivationURL string
+		ExpiresIn     string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, token),
+		ExpiresIn:     app.config.mail.invitationExp.String(),
+	})
+	if err == nil {
+		err = app.mailer.Send(ctx, msg)
+	}
+	if err != nil {
+		// Roll back the account so the user can register again
+		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
+			app.logger.Errorw("Failed to delete user after invitation error", "user_id", user.ID, "error", err)
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, user); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 }
 
 type loginPayload struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	// Email is capped like at registration; it also keys the failure counter.
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required"`
 }
 
 // loginHandler authenticates a user and returns a JWT access token.
@@ -77,33 +435,303 @@ func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if payload.Email == "" || payload.Password == "" {
-		app.badRequest(w, r, errors.New("email and password are required"))
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if app.loginLocked(w, r, payload.Email) {
 		return
 	}
 
 	user, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
-	if err != nil {
-		app.notFound(w, r, err)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
 		return
 	}
 
-	// NOTE: In production, compare password hashes. This demo uses plaintext from seed data.
-	if user.Password != payload.Password {
+	// Unknown emails go through the same bcrypt comparison and failure
+	// tracking as wrong passwords so both answers look alike
+	candidate := user
+	if candidate == nil {
+		candidate = dummyUser()
+	}
+
+	if err := candidate.Password.Compare(payload.Password); err != nil || user == nil {
+		if err := app.recordLoginFailure(r, payload.Email, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
 		writeJSONError(w, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
 
-	token, err := app.jwt.GenerateToken(user.ID, user.Username, app.config.auth.AccessTokenTTL)
+	if err := app.store.LoginFailures.Reset(r.Context(), accountLoginKey(payload.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !user.IsActive {
+		writeJSONError(w, http.StatusForbidden, "account is not activated")
+		return
+	}
+
+	mfa, err := app.store.MFA.GetByUserID(r.Context(), user.ID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	case mfa.Enabled:
+		app.mfaChallenge(w, r, user)
+		return
+	}
+
+	tokens, err := app.startSession(r, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusOK, tokens)
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// startSession records a new login session for the request's device and
+// issues its first tokens.
+func (app *application) startSession(r *http.Request, user *store.User) (*tokenResponse, error) {
+	id, err := iauth.NewID()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session := &store.Session{ID: id, UserID: user.ID, UserAgent: userAgent, IP: clientIP(r)}
+	if err := app.store.Sessions.Create(r.Context(), session); err != nil {
+		return nil, err
+	}
+
+	return app.issueTokens(r.Context(), user, session.ID)
+}
+
+// issueTokens signs an access token and stores a new refresh token for the
+// session. The session ID doubles as the refresh token family.
+func (app *application) issueTokens(ctx context.Context, user *store.User, sessionID string) (*tokenResponse, error) {
+	token, err := app.generateAccessToken(ctx, user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, rt, err := app.newRefreshToken(user.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := app.store.RefreshTokens.Create(ctx, rt); err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{Token: token, RefreshToken: refresh}, nil
+}
+
+// generateAccessToken signs an access token carrying the user's current roles
+// for a session.
+func (app *application) generateAccessToken(ctx context.Context, user *store.User, sessionID string) (string, error) {
+	roles, err := app.store.Roles.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	return app.jwt.GenerateToken(user.ID, user.Username, app.config.auth.AccessTokenTTL, iauth.WithRoles(roles...), iauth.WithSession(sessionID))
+}
+
+// newRefreshToken generates a refresh token and the record to persist for it.
+func (app *application) newRefreshToken(userID int64, familyID string) (string, *store.RefreshToken, error) {
+	refresh, hash, err := iauth.NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refresh, &store.RefreshToken{
+		UserID:    userID,
+		TokenHash: hash,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(app.config.auth.RefreshTokenTTL),
+	}, nil
+}
+
+type refreshPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// refreshTokenHandler exchanges a refresh token for a new access/refresh token pair.
+// Presenting a token that was already rotated revokes its whole family.
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload refreshPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	current, err := app.store.RefreshTokens.GetByHash(ctx, iauth.HashOpaqueToken(payload.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeJSONError(w, http.StatusUnauthorized, "invalid refresh token")
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	session, err := app.store.Sessions.GetByID(ctx, current.FamilyID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if session == nil || session.RevokedAt != nil {
+		// Signed out, not a stolen token
+		writeJSONError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+
+	if current.RevokedAt != nil {
+		app.refreshTokenReused(w, r, current)
+		return
+	}
+
+	if time.Now().After(current.ExpiresAt) {
+		writeJSONError(w, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, current.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeJSONError(w, http.StatusUnauthorized, "user not found")
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.IsActive {
+		writeJSONError(w, http.StatusForbidden, "account is not activated")
+		return
+	}
+
+	token, err := app.generateAccessToken(ctx, user, session.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	refresh, next, err := app.newRefreshToken(user.ID, current.FamilyID)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	_ = app.jsonResponse(w, http.StatusOK, map[string]string{"token": token})
+	if err := app.store.RefreshTokens.Rotate(ctx, current, next); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			// Another request rotated this token first.
+			app.refreshTokenReused(w, r, current)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Sessions.Touch(ctx, session.ID, clientIP(r)); err != nil {
+		app.logger.Errorw("Failed to update session", "session_id", session.ID, "error", err)
+	}
+
+	_ = app.jsonResponse(w, http.StatusOK, &tokenResponse{Token: token, RefreshToken: refresh})
+}
+
+// refreshTokenReused revokes the token family after a rotated token was presented again.
+func (app *application) refreshTokenReused(w http.ResponseWriter, r *http.Request, token *store.RefreshToken) {
+	app.logger.Warnw("Refresh token reuse detected", "user_id", token.UserID, "family_id", token.FamilyID)
+
+	if err := app.store.RefreshTokens.RevokeFamily(r.Context(), token.FamilyID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	writeJSONError(w, http.StatusUnauthorized, "invalid refresh token")
+}
+
+type logoutPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// logoutHandler revokes the access token used for the request and ends its
+// session. A refresh token from another login may be given to end that one too.
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload logoutPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+	claims := getCurrentClaims(ctx)
+
+	if err := app.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if claims.SessionID != "" {
+		if err := app.store.Sessions.Revoke(ctx, current.ID, claims.SessionID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if payload.RefreshToken != "" {
+		rt, err := app.store.RefreshTokens.GetByHash(ctx, iauth.HashOpaqueToken(payload.RefreshToken))
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			// Nothing to revoke
+		case err != nil:
+			app.internalServerError(w, r, err)
+			return
+		case rt.UserID == current.ID:
+			if err := app.store.RefreshTokens.RevokeFamily(ctx, rt.FamilyID); err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// authzDebugHeader asks the authorize middleware to explain its decision in the
+// X-Authz-Rule and X-Authz-Reason response headers. It is ignored in production.
+const authzDebugHeader = "X-Debug-Authz"
+
 // authorize returns a middleware that enforces a policy action on a resource extracted from the request.
+// Every decision is recorded in the audit sink.
 func (app *application) authorize(action string, extract func(*http.Request) (iauth.Resource, error)) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -119,8 +747,39 @@ func (app *application) authorize(action string, extract func(*http.Request) (ia
 				return
 			}
 
-			sub := iauth.Subject{UserID: current.ID}
-			if app.policy.Authorize(sub, action, res) {
+			// Roles are read from the database rather than the token so that
+			// revoking a role takes effect immediately
+			roles, err := app.store.Roles.GetByUserID(r.Context(), current.ID)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			sub := iauth.Subject{UserID: current.ID, Roles: roles}
+			decision := app.decide(r.Context(), sub, action, res)
+
+			entry := audit.Entry{
+				Time:            time.Now(),
+				RequestID:       middleware.GetReqID(r.Context()),
+				UserID:          sub.UserID,
+				Roles:           sub.Roles,
+				Action:          action,
+				ResourceType:    res.Type,
+				ResourceOwnerID: res.OwnerID,
+				Allowed:         decision.Allowed,
+				Rule:            decision.Rule,
+				Reason:          decision.Reason,
+			}
+			if err := app.audit.Record(r.Context(), entry); err != nil {
+				app.logger.Errorw("Failed to record authorization decision", "request_id", entry.RequestID, "error", err)
+			}
+
+			if app.config.env != "production" && r.Header.Get(authzDebugHeader) != "" {
+				w.Header().Set("X-Authz-Rule", decision.Rule)
+				w.Header().Set("X-Authz-Reason", decision.Reason)
+			}
+
+			if decision.Allowed {
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -130,6 +789,22 @@ func (app *application) authorize(action string, extract func(*http.Request) (ia
 	}
 }
 
+// decide checks the scope of the personal access token used for the request, if
+// any, before consulting the policy.
+func (app *application) decide(ctx context.Context, sub iauth.Subject, action string, res iauth.Resource) iauth.Decision {
+	if pat := getCurrentPAT(ctx); pat != nil {
+		scope, ok := iauth.RequiredScope(action)
+		if !ok {
+			return iauth.Decision{Rule: "token-scope", Reason: fmt.Sprintf("action %q can't be performed with a personal access token", action)}
+		}
+		if !pat.HasScope(scope) {
+			return iauth.Decision{Rule: "token-scope", Reason: fmt.Sprintf("token lacks scope %q", scope)}
+		}
+	}
+
+	return app.policy.Decide(sub, action, res)
+}
+
 // Resource helpers
 func (app *application) resourcePostCreate(r *http.Request) (iauth.Resource, error) {
 	return iauth.Resource{Type: "post"}, nil
@@ -143,6 +818,20 @@ func (app *application) resourcePostFromCtx(r *http.Request) (iauth.Resource, er
 	return iauth.Resource{Type: "post", OwnerID: p.UserID}, nil
 }
 
+// resourceTrashedPostFromCtx describes a deleted post along with who deleted it.
+func (app *application) resourceTrashedPostFromCtx(r *http.Request) (iauth.Resource, error) {
+	p := getPostFromCtx(r)
+	if p == nil {
+		return iauth.Resource{}, errors.New("post not in context")
+	}
+
+	attr := map[string]any{}
+	if p.DeletedBy != nil {
+		attr["deleted_by"] = *p.DeletedBy
+	}
+	return iauth.Resource{Type: "post", OwnerID: p.UserID, Attr: attr}, nil
+}
+
 func (app *application) resourceUserFromCtx(r *http.Request) (iauth.Resource, error) {
 	u := getUserFromContext(r.Context())
 	if u == nil {
@@ -150,3 +839,40 @@ func (app *application) resourceUserFromCtx(r *http.Request) (iauth.Resource, er
 	}
 	return iauth.Resource{Type: "user", OwnerID: u.ID}, nil
 }
+
+func (app *application) resourceCommentCreate(r *http.Request) (iauth.Resource, error) {
+	p := getPostFromCtx(r)
+	if p == nil {
+		return iauth.Resource{}, errors.New("post not in context")
+	}
+	return iauth.Resource{Type: "comment", Attr: map[string]any{"post_owner_id": p.UserID}}, nil
+}
+
+// resourceOwnBookmarks stands for the current user's bookmarks as a whole.
+func (app *application) resourceOwnBookmarks(r *http.Request) (iauth.Resource, error) {
+	return iauth.Resource{Type: "bookmark", OwnerID: getCurrentUser(r.Context()).ID}, nil
+}
+
+func (app *application) resourceBookmarkFromCtx(r *http.Request) (iauth.Resource, error) {
+	b := getBookmarkFromCtx(r)
+	if b == nil {
+		return iauth.Resource{}, errors.New("bookmark not in context")
+	}
+	return iauth.Resource{Type: "bookmark", OwnerID: b.UserID}, nil
+}
+
+func (app *application) resourceBookmarkCollectionFromCtx(r *http.Request) (iauth.Resource, error) {
+	c := getBookmarkCollectionFromCtx(r)
+	if c == nil {
+		return iauth.Resource{}, errors.New("bookmark collection not in context")
+	}
+	return iauth.Resource{Type: "bookmark_collection", OwnerID: c.UserID}, nil
+}
+
+func (app *application) resourceCommentFromCtx(r *http.Request) (iauth.Resource, error) {
+	c := getCommentFromCtx(r)
+	if c == nil {
+		return iauth.Resource{}, errors.New("comment not in context")
+	}
+	return iauth.Resource{Type: "comment", OwnerID: c.UserID, Attr: map[string]any{"post_owner_id": c.PostOwnerID}}, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+// getBlocksHandler lists the users the current user has blocked.
+func (app *application) getBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	blocks, err := app.store.Blocks.GetByUserID(ctx, getCurrentUser(ctx).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, blocks); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// blockUserHandler blocks a user, who can no longer mention the current user.
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	if id == current.ID {
+		app.badRequest(w, r, errors.New("users can't block themselves"))
+		return
+	}
+
+	if err := app.store.Blocks.Block(ctx, current.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := app.store.Blocks.Unblock(ctx, getCurrentUser(ctx).ID, id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
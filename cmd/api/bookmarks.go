@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+type bookmarkKey string
+
+const (
+	bookmarkCtx           bookmarkKey = "bookmark"
+	bookmarkCollectionCtx bookmarkKey = "bookmark_collection"
+)
+
+var errCollectionNotFound = errors.New("collection not found")
+
+type CreateBookmarkPayload struct {
+	PostID       int64  `json:"post_id" validate:"required,gt=0"`
+	CollectionID *int64 `json:"collection_id" validate:"omitempty,gt=0"`
+}
+
+// createBookmarkHandler bookmarks a post for the current user. Bookmarking a
+// post again moves the existing bookmark to the given collection.
+func (app *application) createBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateBookmarkPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+
+	// Only posts the user can see can be bookmarked
+	post, err := app.store.Posts.GetByID(ctx, payload.PostID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFound(w, r, err)
+		return
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	case post.Status != store.PostPublished && post.UserID != current.ID:
+		app.notFound(w, r, store.ErrNotFound)
+		return
+	}
+
+	bookmark := &store.Bookmark{
+		UserID:       current.ID,
+		PostID:       post.ID,
+		CollectionID: payload.CollectionID,
+	}
+
+	if err := app.store.Bookmarks.Save(ctx, bookmark); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequest(w, r, errCollectionNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, bookmark); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+var defaultBookmarkQuery = store.PaginatedBookmarkQuery{
+	Limit: 20,
+}
+
+// getBookmarksHandler lists the current user's bookmarks with their posts,
+// newest first, optionally from one collection.
+func (app *application) getBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	bq, err := defaultBookmarkQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(bq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	page, err := app.store.Bookmarks.GetByUserID(ctx, getCurrentUser(ctx).ID, bq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	posts := make([]*store.Post, len(page.Bookmarks))
+	for i := range page.Bookmarks {
+		posts[i] = &page.Bookmarks[i].Post.Post
+	}
+	if err := app.loadPostReactions(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMentions(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMedia(ctx, posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getBookmarkFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type UpdateBookmarkPayload struct {
+	// CollectionID moves the bookmark; null takes it out of its collection.
+	CollectionID *int64 `json:"collection_id" validate:"omitempty,gt=0"`
+}
+
+func (app *application) updateBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateBookmarkPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	bookmark := getBookmarkFromCtx(r)
+	bookmark.CollectionID = payload.CollectionID
+
+	if err := app.store.Bookmarks.Move(r.Context(), bookmark); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequest(w, r, errCollectionNotFound)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, bookmark); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deleteBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.store.Bookmarks.Delete(r.Context(), getBookmarkFromCtx(r).ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type BookmarkCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+func (app *application) createBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	collection := &store.BookmarkCollection{
+		UserID: getCurrentUser(ctx).ID,
+		Name:   payload.Name,
+	}
+
+	if err := app.store.BookmarkCollections.Create(ctx, collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateCollection):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getBookmarkCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	collections, err := app.store.BookmarkCollections.GetByUserID(ctx, getCurrentUser(ctx).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getBookmarkCollectionFromCtx(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) updateBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var payload BookmarkCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	collection := getBookmarkCollectionFromCtx(r)
+	collection.Name = payload.Name
+
+	if err := app.store.BookmarkCollections.Rename(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDuplicateCollection):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collection); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteBookmarkCollectionHandler deletes a collection. Its bookmarks are kept
+// outside of any collection.
+func (app *application) deleteBookmarkCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.store.BookmarkCollections.Delete(r.Context(), getBookmarkCollectionFromCtx(r).ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) bookmarkContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "bookmarkID"), 10, 64)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		bookmark, err := app.store.Bookmarks.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, bookmarkCtx, bookmark)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getBookmarkFromCtx(r *http.Request) *store.Bookmark {
+	bookmark, ok := r.Context().Value(bookmarkCtx).(*store.Bookmark)
+	if !ok {
+		return nil
+	}
+	return bookmark
+}
+
+func (app *application) bookmarkCollectionContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		collection, err := app.store.BookmarkCollections.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, bookmarkCollectionCtx, collection)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getBookmarkCollectionFromCtx(r *http.Request) *store.BookmarkCollection {
+	collection, ok := r.Context().Value(bookmarkCollectionCtx).(*store.BookmarkCollection)
+	if !ok {
+		return nil
+	}
+	return collection
+}
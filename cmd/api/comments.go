@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
+// defaultCommentQuery is used when a request doesn't page through comments itself.
+var defaultCommentQuery = store.PaginatedCommentQuery{
+	Limit: 20,
+	Sort:  "desc",
+}
+
+type CreateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+	// ParentID makes the comment a reply to another comment on the same post.
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gt=0"`
+}
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	post := getPostFromCtx(r)
+	current := getCurrentUser(ctx)
+
+	if payload.ParentID != nil {
+		parent, err := app.store.Comments.GetByID(ctx, *payload.ParentID)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequest(w, r, errors.New("parent comment not found"))
+			return
+		case err != nil:
+			app.internalServerError(w, r, err)
+			return
+		case parent.PostID != post.ID:
+			app.badRequest(w, r, errors.New("parent comment belongs to another post"))
+			return
+		}
+	}
+
+	comment := &store.Comment{
+		PostID:   post.ID,
+		ParentID: payload.ParentID,
+		UserID:   current.ID,
+		Content:  payload.Content,
+		User:     store.User{ID: current.ID, Username: current.Username},
+	}
+
+	mentions, err := app.resolveMentions(ctx, current.ID, comment.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	comment.Entities.Mentions = mentions
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// Comment listings nest replies under their parent by default; view=flat
+// returns them as one list in thread order instead.
+const (
+	commentViewTree = "tree"
+	commentViewFlat = "flat"
+)
+
+// getCommentsHandler lists the top-level comments on a post a page at a time,
+// with ?depth= levels of replies. Pass the returned next_cursor as ?cursor= to
+// get the next page.
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	app.listComments(w, r, defaultCommentQuery, func(ctx context.Context, cq store.PaginatedCommentQuery) (*store.CommentPage, error) {
+		return app.store.Comments.GetByPostID(ctx, post.ID, cq)
+	})
+}
+
+// getRepliesHandler pages through the direct replies to a comment, oldest first.
+func (app *application) getRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	defaults := defaultCommentQuery
+	defaults.Sort = "asc"
+
+	app.listComments(w, r, defaults, func(ctx context.Context, cq store.PaginatedCommentQuery) (*store.CommentPage, error) {
+		return app.store.Comments.GetReplies(ctx, comment.ID, cq)
+	})
+}
+
+func (app *application) listComments(w http.ResponseWriter, r *http.Request, defaults store.PaginatedCommentQuery, list func(context.Context, store.PaginatedCommentQuery) (*store.CommentPage, error)) {
+	cq, err := defaults.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	view := r.URL.Query().Get("view")
+	if view != "" && view != commentViewTree && view != commentViewFlat {
+		app.badRequest(w, r, errors.New("view must be tree or flat"))
+		return
+	}
+
+	cq.Depth = min(cq.Depth, app.config.comments.maxDepth)
+
+	page, err := list(r.Context(), cq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadCommentReactions(r.Context(), page.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadCommentMentions(r.Context(), page.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if view == commentViewFlat {
+		page.Comments = page.Flatten()
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	comment := getCommentFromCtx(r)
+	comment.Content = payload.Content
+
+	mentions, err := app.resolveMentions(r.Context(), comment.UserID, comment.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	comment.Entities.Mentions = mentions
+
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteCommentHandler deletes a comment and the replies below it.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if err := app.store.Comments.Delete(r.Context(), comment.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		comment, err := app.store.Comments.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		// Comments on drafts and scheduled posts are as hidden as the post
+		if comment.PostStatus != store.PostPublished {
+			if current := getCurrentUser(ctx); current == nil || current.ID != comment.PostOwnerID {
+				app.notFound(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromCtx(r *http.Request) *store.Comment {
+	comment, ok := r.Context().Value(commentCtx).(*store.Comment)
+	if !ok {
+		return nil
+	}
+	return comment
+}
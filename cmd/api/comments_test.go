@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusuf-cirak/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type fakeCommentStore struct {
+	comments map[int64]*store.Comment
+	page     *store.CommentPage
+	// query is the last query passed to GetByPostID or GetReplies.
+	query   store.PaginatedCommentQuery
+	created []*store.Comment
+}
+
+func (s *fakeCommentStore) Create(_ context.Context, c *store.Comment) error {
+	c.ID = int64(len(s.comments) + len(s.created) + 100)
+	s.created = append(s.created, c)
+	return nil
+}
+
+func (s *fakeCommentStore) GetByID(_ context.Context, id int64) (*store.Comment, error) {
+	c, ok := s.comments[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return c, nil
+}
+
+func (s *fakeCommentStore) GetByPostID(_ context.Context, _ int64, cq store.PaginatedCommentQuery) (*store.CommentPage, error) {
+	s.query = cq
+	return s.page, nil
+}
+
+func (s *fakeCommentStore) GetReplies(_ context.Context, _ int64, cq store.PaginatedCommentQuery) (*store.CommentPage, error) {
+	s.query = cq
+	return s.page, nil
+}
+
+func (s *fakeCommentStore) Update(context.Context, *store.Comment) error { return nil }
+
+func (s *fakeCommentStore) Delete(context.Context, int64) error { return nil }
+
+type fakeReactionStore struct{}
+
+func (fakeReactionStore) Add(context.Context, *store.Reaction) error    { return nil }
+func (fakeReactionStore) Remove(context.Context, *store.Reaction) error { return nil }
+func (fakeReactionStore) Summarize(context.Context, string, []int64, int64) (map[int64]store.Reactions, error) {
+	return nil, nil
+}
+
+type fakeMentionStore struct{}
+
+func (fakeMentionStore) GetByPostIDs(context.Context, []int64) (map[int64][]store.Mention, error) {
+	return nil, nil
+}
+func (fakeMentionStore) GetByCommentIDs(context.Context, []int64) (map[int64][]store.Mention, error) {
+	return nil, nil
+}
+
+func newCommentTestApp(comments *fakeCommentStore, maxDepth int) *application {
+	return &application{
+		config: config{comments: commentsConfig{maxDepth: maxDepth}},
+		store: store.Storage{
+			Comments:  comments,
+			Reactions: fakeReactionStore{},
+			Mentions:  fakeMentionStore{},
+		},
+		logger: zap.NewNop().Sugar(),
+	}
+}
+
+func withPost(r *http.Request, post *store.Post) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), postCtx, post))
+}
+
+func TestGetCommentsHandler_CapsDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"default", "", 0},
+		{"below cap", "?depth=1", 1},
+		{"at cap", "?depth=2", 2},
+		{"above cap", "?depth=50", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments := &fakeCommentStore{page: &store.CommentPage{Comments: []store.Comment{}}}
+			app := newCommentTestApp(comments, 2)
+
+			r := withPost(httptest.NewRequest(http.MethodGet, "/v1/posts/1/comments"+tt.query, nil), &store.Post{ID: 1})
+			w := httptest.NewRecorder()
+			app.getCommentsHandler(w, r)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, tt.want, comments.query.Depth)
+		})
+	}
+}
+
+func TestGetCommentsHandler_FlatView(t *testing.T) {
+	comments := &fakeCommentStore{page: &store.CommentPage{
+		Comments: []store.Comment{
+			{ID: 1, Replies: []store.Comment{
+				{ID: 3, Replies: []store.Comment{{ID: 4}}},
+			}},
+			{ID: 2},
+		},
+	}}
+	app := newCommentTestApp(comments, 5)
+
+	r := withPost(httptest.NewRequest(http.MethodGet, "/v1/posts/1/comments?depth=2&view=flat", nil), &store.Post{ID: 1})
+	w := httptest.NewRecorder()
+	app.getCommentsHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var body struct {
+		Data struct {
+			Comments []struct {
+				ID      int64             `json:"id"`
+				Replies []json.RawMessage `json:"replies"`
+			} `json:"comments"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+
+	var ids []int64
+	for _, c := range body.Data.Comments {
+		ids = append(ids, c.ID)
+		assert.Empty(t, c.Replies, "comment %d is still nested", c.ID)
+	}
+	assert.Equal(t, []int64{1, 3, 4, 2}, ids)
+}
+
+func TestGetCommentsHandler_UnknownView(t *testing.T) {
+	app := newCommentTestApp(&fakeCommentStore{}, 5)
+
+	r := withPost(httptest.NewRequest(http.MethodGet, "/v1/posts/1/comments?view=threaded", nil), &store.Post{ID: 1})
+	w := httptest.NewRecorder()
+	app.getCommentsHandler(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateCommentHandler_Parent(t *testing.T) {
+	tests := []struct {
+		name     string
+		parentID int64
+		want     int
+	}{
+		{"same post", 10, http.StatusCreated},
+		{"another post", 20, http.StatusBadRequest},
+		{"missing", 30, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments := &fakeCommentStore{comments: map[int64]*store.Comment{
+				10: {ID: 10, PostID: 1},
+				20: {ID: 20, PostID: 2},
+			}}
+			app := newCommentTestApp(comments, 5)
+
+			body := strings.NewReader(fmt.Sprintf(`{"content": "a reply", "parent_id": %d}`, tt.parentID))
+			r := withPost(httptest.NewRequest(http.MethodPost, "/v1/posts/1/comments", body), &store.Post{ID: 1})
+			r = r.WithContext(context.WithValue(r.Context(), currentUserCtxKey, &store.User{ID: 7, Username: "alice"}))
+			w := httptest.NewRecorder()
+			app.createCommentHandler(w, r)
+
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+			if tt.want == http.StatusCreated {
+				require.Len(t, comments.created, 1)
+				assert.Equal(t, int64(1), comments.created[0].PostID)
+				assert.Equal(t, tt.parentID, *comments.created[0].ParentID)
+			} else {
+				assert.Empty(t, comments.created)
+			}
+		})
+	}
+}
+
+func TestCommentsContextMiddleware_PostVisibility(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		current *store.User
+		want    int
+	}{
+		{"published, anonymous", store.PostPublished, nil, http.StatusOK},
+		{"draft, anonymous", store.PostDraft, nil, http.StatusNotFound},
+		{"draft, someone else", store.PostDraft, &store.User{ID: 8}, http.StatusNotFound},
+		{"draft, post owner", store.PostDraft, &store.User{ID: 7}, http.StatusOK},
+		{"scheduled, someone else", store.PostScheduled, &store.User{ID: 8}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments := &fakeCommentStore{comments: map[int64]*store.Comment{
+				10: {ID: 10, PostID: 1, UserID: 8, PostOwnerID: 7, PostStatus: tt.status},
+			}}
+			app := newCommentTestApp(comments, 5)
+
+			router := chi.NewRouter()
+			router.With(app.commentsContextMiddleware).Get("/comments/{commentID}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/comments/10", nil)
+			if tt.current != nil {
+				r = r.WithContext(context.WithValue(r.Context(), currentUserCtxKey, tt.current))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 )
 
@@ -24,3 +25,32 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	w.Header().Set("Retry-After", retryAfter)
 	writeJSONError(w, http.StatusTooManyRequests, "Rate limit exceeded")
 }
+
+func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("Conflict", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeJSONError(w, http.StatusConflict, err.Error())
+}
+
+func (app *application) payloadTooLarge(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	app.logger.Warnw("Payload too large", "method", r.Method, "path", r.URL.Path, "max_bytes", maxBytes)
+	writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("file must not be larger than %d bytes", maxBytes))
+}
+
+func (app *application) unsupportedMediaType(w http.ResponseWriter, r *http.Request, err error) {
+	app.logger.Warnw("Unsupported media type", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
+
+// preconditionFailed tells the client its copy of a resource is stale and
+// which version it needs to fetch.
+func (app *application) preconditionFailed(w http.ResponseWriter, r *http.Request, currentVersion int) {
+	app.logger.Warnw("Precondition failed", "method", r.Method, "path", r.URL.Path, "current_version", currentVersion)
+
+	type envelope struct {
+		Error          string `json:"error"`
+		CurrentVersion int    `json:"current_version"`
+	}
+
+	w.Header().Set("ETag", versionETag(currentVersion))
+	writeJSON(w, http.StatusPreconditionFailed, envelope{Error: "resource was modified", CurrentVersion: currentVersion})
+}
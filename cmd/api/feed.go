@@ -27,12 +27,33 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	ctx := r.Context()
 
-	posts, err := app.store.Posts.GetUserFeed(ctx, int64(42), fq)
+	posts, err := app.store.Posts.GetUserFeed(ctx, getCurrentUser(ctx).ID, fq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	feedPosts := make([]*store.Post, 0, len(posts))
+	for _, p := range posts {
+		if !p.Tombstone {
+			feedPosts = append(feedPosts, &p.Post)
+		}
+	}
+	if err := app.loadPostReactions(ctx, feedPosts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMedia(ctx, feedPosts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMentions(ctx, feedPosts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/auth"
+)
+
+const (
+	revokedTokenPurgeInterval   = 10 * time.Minute
+	policyFileCheckInterval     = 5 * time.Second
+	oidcLoginStatePurgeInterval = time.Hour
+	loginFailurePurgeInterval   = time.Hour
+	deletedPostPurgeInterval    = time.Hour
+	scheduledPostInterval       = 15 * time.Second
+	orphanedMediaPurgeInterval  = time.Hour
+	// scheduledPostBatchSize is how many posts are published per transaction.
+	scheduledPostBatchSize = 100
+	// orphanedMediaAge is how long an upload can stay unattached to a post.
+	orphanedMediaAge       = 24 * time.Hour
+	orphanedMediaBatchSize = 100
+)
+
+// startBackgroundJobs launches the periodic maintenance jobs. They stop when
+// ctx is cancelled; the returned function waits until they have.
+func (app *application) startBackgroundJobs(ctx context.Context) (wait func()) {
+	var wg sync.WaitGroup
+	start := func(job func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job()
+		}()
+	}
+
+	start(func() {
+		app.runPeriodically(ctx, "purge revoked tokens", revokedTokenPurgeInterval, app.revocations.PurgeExpired)
+	})
+	start(func() {
+		app.runPeriodically(ctx, "purge oidc login states", oidcLoginStatePurgeInterval, app.store.Identities.PurgeExpiredLoginStates)
+	})
+	start(func() {
+		app.runPeriodically(ctx, "purge login failures", loginFailurePurgeInterval, func(ctx context.Context) error {
+			return app.store.LoginFailures.PurgeStale(ctx, loginFailurePurgeAge)
+		})
+	})
+	start(func() {
+		app.runPeriodically(ctx, "purge deleted posts", deletedPostPurgeInterval, func(ctx context.Context) error {
+			return app.store.Posts.PurgeDeleted(ctx, app.config.posts.trashRetention)
+		})
+	})
+	start(func() {
+		app.runPeriodically(ctx, "publish scheduled posts", scheduledPostInterval, app.publishScheduledPosts)
+	})
+	start(func() {
+		app.runPeriodically(ctx, "purge orphaned media", orphanedMediaPurgeInterval, app.purgeOrphanedMedia)
+	})
+
+	if policy, ok := app.policy.(*auth.FilePolicy); ok {
+		start(func() { app.watchPolicyFile(ctx, policy) })
+	}
+
+	return wg.Wait
+}
+
+// publishScheduledPosts publishes the posts that are due, one batch at a
+// time. A batch that has started is committed even if ctx is cancelled by a
+// shutdown; the remaining batches are left to the next run or another replica.
+func (app *application) publishScheduledPosts(ctx context.Context) error {
+	for ctx.Err() == nil {
+		published, err := app.store.Posts.PublishDue(context.WithoutCancel(ctx), scheduledPostBatchSize)
+		if err != nil {
+			return err
+		}
+		if published > 0 {
+			app.logger.Infow("published scheduled posts", "count", published)
+		}
+		if published < scheduledPostBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// watchPolicyFile reloads the policy file when it changes on disk or when the
+// process receives SIGHUP.
+func (app *application) watchPolicyFile(ctx context.Context, policy *auth.FilePolicy) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(policyFileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := policy.Reload(); err != nil {
+				app.logger.Errorw("policy reload failed, keeping previous policy", "path", policy.Path(), "error", err)
+				continue
+			}
+			app.logger.Infow("policy reloaded", "path", policy.Path(), "trigger", "SIGHUP")
+		case <-ticker.C:
+			reloaded, err := policy.ReloadIfChanged()
+			if err != nil {
+				app.logger.Errorw("policy reload failed, keeping previous policy", "path", policy.Path(), "error", err)
+				continue
+			}
+			if reloaded {
+				app.logger.Infow("policy reloaded", "path", policy.Path(), "trigger", "file change")
+			}
+		}
+	}
+}
+
+// runPeriodically calls fn every interval until ctx is cancelled, logging failures.
+func (app *application) runPeriodically(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				app.logger.Errorw("background job failed", "job", name, "error", err)
+			}
+		}
+	}
+}
@@ -3,14 +3,28 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"slices"
 
 	"github.com/go-playground/validator/v10"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/mention"
 )
 
 var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// scope accepts the personal access token scopes known to the auth
+	// package, so new scopes don't need to be listed in payload tags too
+	Validate.RegisterValidation("scope", func(fl validator.FieldLevel) bool {
+		return slices.Contains(iauth.Scopes, fl.Field().String())
+	})
+
+	// username accepts the usernames that @mentions can refer to
+	Validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return mention.ValidUsername(fl.Field().String())
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data interface{}) error {
@@ -20,10 +34,12 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) error {
 	return json.NewEncoder(w).Encode(data)
 }
 
-func readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
-	maxBytes := 1_048_578
+// maxJSONBytes caps JSON request bodies. File uploads have their own limit,
+// see uploadMediaHandler.
+const maxJSONBytes = 1_048_578
 
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+func readJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxJSONBytes)
 
 	jsonDecoder := json.NewDecoder(r.Body)
 	jsonDecoder.DisallowUnknownFields()
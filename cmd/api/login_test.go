@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type fakeUserStore struct {
+	users []*store.User
+}
+
+func (s *fakeUserStore) GetByID(_ context.Context, id int64) (*store.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *fakeUserStore) GetByEmail(_ context.Context, email string) (*store.User, error) {
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *fakeUserStore) Create(context.Context, *store.User) error { return nil }
+func (s *fakeUserStore) CreateAndInvite(context.Context, *store.User, []byte, time.Duration) error {
+	return nil
+}
+func (s *fakeUserStore) Activate(context.Context, []byte) error { return nil }
+func (s *fakeUserStore) Delete(context.Context, int64) error    { return nil }
+func (s *fakeUserStore) CreatePasswordReset(context.Context, int64, []byte, time.Duration) error {
+	return nil
+}
+func (s *fakeUserStore) ResetPassword(context.Context, []byte, *store.User) error { return nil }
+func (s *fakeUserStore) UpdatePassword(context.Context, *store.User) error        { return nil }
+func (s *fakeUserStore) GetMentionable(context.Context, int64, []string) ([]*store.User, error) {
+	return nil, nil
+}
+
+// fakeLoginFailureStore counts failures and locks keys in memory. Windows are
+// not tracked.
+type fakeLoginFailureStore struct {
+	failures map[string]int
+	locks    map[string]time.Time
+}
+
+func newFakeLoginFailureStore() *fakeLoginFailureStore {
+	return &fakeLoginFailureStore{failures: map[string]int{}, locks: map[string]time.Time{}}
+}
+
+func (s *fakeLoginFailureStore) LockedUntil(_ context.Context, keys []string) (time.Time, error) {
+	var until time.Time
+	for _, key := range keys {
+		if t := s.locks[key]; t.After(time.Now()) && t.After(until) {
+			until = t
+		}
+	}
+	return until, nil
+}
+
+func (s *fakeLoginFailureStore) RecordFailure(_ context.Context, key string, _ time.Duration) (int, error) {
+	s.failures[key]++
+	return s.failures[key], nil
+}
+
+func (s *fakeLoginFailureStore) Lock(_ context.Context, key string, until time.Time) error {
+	s.locks[key] = until
+	return nil
+}
+
+func (s *fakeLoginFailureStore) Reset(_ context.Context, key string) error {
+	delete(s.failures, key)
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *fakeLoginFailureStore) PurgeStale(context.Context, time.Duration) error { return nil }
+
+type fakeSecurityEventStore struct {
+	events []*store.SecurityEvent
+}
+
+func (s *fakeSecurityEventStore) Create(_ context.Context, e *store.SecurityEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+const loginTestThreshold = 3
+
+func newLoginTestApp(t *testing.T) (*application, *fakeSecurityEventStore) {
+	t.Helper()
+
+	alice := &store.User{ID: 7, Username: "alice", Email: "alice@example.com", IsActive: true}
+	require.NoError(t, alice.Password.Set("correct horse battery"))
+
+	events := &fakeSecurityEventStore{}
+	app := &application{
+		config: config{auth: authConfig{
+			AccountLockout: iauth.LockoutPolicy{
+				FreeAttempts:    loginTestThreshold - 1,
+				Threshold:       loginTestThreshold,
+				LockoutDuration: 15 * time.Minute,
+				Window:          time.Hour,
+			},
+		}},
+		store: store.Storage{
+			Users:          &fakeUserStore{users: []*store.User{alice}},
+			LoginFailures:  newFakeLoginFailureStore(),
+			SecurityEvents: events,
+		},
+		logger: zap.NewNop().Sugar(),
+	}
+	return app, events
+}
+
+func login(app *application, email, password string) *httptest.ResponseRecorder {
+	body := strings.NewReader(`{"email": ` + strconv.Quote(email) + `, "password": ` + strconv.Quote(password) + `}`)
+	r := httptest.NewRequest(http.MethodPost, "/v1/auth/login", body)
+	w := httptest.NewRecorder()
+	app.loginHandler(w, r)
+	return w
+}
+
+func TestLoginHandler_UnknownEmailLooksLikeWrongPassword(t *testing.T) {
+	app, _ := newLoginTestApp(t)
+
+	unknown := login(app, "bob@example.com", "correct horse battery")
+	wrong := login(app, "alice@example.com", "wrong password")
+
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, unknown.Code, wrong.Code)
+	assert.Equal(t, unknown.Body.String(), wrong.Body.String())
+}
+
+func TestLoginHandler_LocksOutAfterThreshold(t *testing.T) {
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		t.Run(email, func(t *testing.T) {
+			app, events := newLoginTestApp(t)
+
+			for i := 1; i <= loginTestThreshold; i++ {
+				w := login(app, email, "wrong password")
+				require.Equal(t, http.StatusUnauthorized, w.Code, "failure %d", i)
+			}
+
+			// Locked, even with the right password
+			w := login(app, email, "correct horse battery")
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+			require.NoError(t, err)
+			assert.Greater(t, retryAfter, 0)
+			assert.LessOrEqual(t, retryAfter, int((15 * time.Minute).Seconds()))
+
+			require.Len(t, events.events, 1)
+			event := events.events[0]
+			assert.Equal(t, store.SecurityEventLoginLockout, event.Type)
+			if email == "alice@example.com" {
+				require.NotNil(t, event.UserID)
+				assert.Equal(t, int64(7), *event.UserID)
+			} else {
+				assert.Nil(t, event.UserID)
+			}
+		})
+	}
+}
+
+func TestLoginHandler_RejectsOverlongEmail(t *testing.T) {
+	app, _ := newLoginTestApp(t)
+
+	w := login(app, strings.Repeat("a", 320)+"@example.com", "wrong password")
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
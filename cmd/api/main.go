@@ -1,11 +1,14 @@
 package main
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/blob"
 	"github.com/yusuf-cirak/social/internal/db"
 	"github.com/yusuf-cirak/social/internal/env"
+	"github.com/yusuf-cirak/social/internal/mailer"
 	"github.com/yusuf-cirak/social/internal/ratelimiter"
 	"github.com/yusuf-cirak/social/internal/store"
 	"go.uber.org/zap"
@@ -13,6 +16,9 @@ import (
 
 const version = "1.0.0"
 
+// defaultMFAEncryptionKey only protects TOTP secrets in development.
+const defaultMFAEncryptionKey = "dev-mfa-key-change"
+
 func main() {
 	cfg := config{addr: env.GetString("ADDR", ":8080"),
 		db: dbConfig{
@@ -21,12 +27,63 @@ func main() {
 			maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 25),
 			maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "5m"),
 		},
-		env: env.GetString("ENV", "development"),
+		env:         env.GetString("ENV", "development"),
+		frontendURL: env.GetString("FRONTEND_URL", "http://localhost:5173"),
+		mail: mailConfig{
+			dir:              env.GetString("MAIL_DIR", "tmp/mail"),
+			fromEmail:        env.GetString("MAIL_FROM_EMAIL", "no-reply@social.local"),
+			invitationExp:    time.Duration(env.GetInt("MAIL_INVITATION_EXP_HOURS", 72)) * time.Hour,
+			passwordResetExp: time.Duration(env.GetInt("PASSWORD_RESET_EXP_MINUTES", 60)) * time.Minute,
+		},
+		comments: commentsConfig{
+			maxDepth: env.GetInt("COMMENT_MAX_DEPTH", 5),
+		},
+		posts: postsConfig{
+			trashRetention: time.Duration(env.GetInt("POST_TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		},
+		media: mediaConfig{
+			maxUploadBytes: int64(env.GetInt("MEDIA_MAX_UPLOAD_MB", 10)) << 20,
+			blobBackend:    env.GetString("BLOB_BACKEND", "fs"),
+			blobDir:        env.GetString("BLOB_DIR", "tmp/media"),
+			s3: blob.S3Config{
+				Endpoint:        env.GetString("S3_ENDPOINT", "http://localhost:9000"),
+				Region:          env.GetString("S3_REGION", "us-east-1"),
+				Bucket:          env.GetString("S3_BUCKET", "social-media"),
+				AccessKeyID:     env.GetString("S3_ACCESS_KEY_ID", ""),
+				SecretAccessKey: env.GetString("S3_SECRET_ACCESS_KEY", ""),
+			},
+		},
 		auth: authConfig{
-			Secret:         env.GetString("JWT_SECRET", "dev-secret-change"),
-			Issuer:         env.GetString("JWT_ISSUER", "social-go"),
-			Audience:       env.GetString("JWT_AUDIENCE", "social-users"),
-			AccessTokenTTL: time.Duration(env.GetInt("JWT_TTL_MINUTES", 60)) * time.Minute,
+			Secret:          env.GetString("JWT_SECRET", "dev-secret-change"),
+			Issuer:          env.GetString("JWT_ISSUER", "social-go"),
+			Audience:        env.GetString("JWT_AUDIENCE", "social-users"),
+			AccessTokenTTL:  time.Duration(env.GetInt("JWT_TTL_MINUTES", 60)) * time.Minute,
+			RefreshTokenTTL: time.Duration(env.GetInt("JWT_REFRESH_TTL_HOURS", 720)) * time.Hour,
+
+			RevocationBackend: env.GetString("JWT_REVOCATION_BACKEND", "postgres"),
+			SigningKeys:       env.GetString("JWT_SIGNING_KEYS", ""),
+			ActiveKeyID:       env.GetString("JWT_ACTIVE_KID", ""),
+			PolicyFile:        env.GetString("POLICY_FILE", ""),
+			AuditSinks:        env.GetString("AUDIT_SINKS", "zap"),
+			MFAEncryptionKey:  env.GetString("MFA_ENCRYPTION_KEY", defaultMFAEncryptionKey),
+			MFAPendingTTL:     time.Duration(env.GetInt("MFA_PENDING_TTL_MINUTES", 5)) * time.Minute,
+			OIDCProvidersFile: env.GetString("OIDC_PROVIDERS_FILE", ""),
+			AccountLockout: auth.LockoutPolicy{
+				FreeAttempts:    3,
+				BaseDelay:       time.Second,
+				MaxDelay:        time.Minute,
+				Threshold:       env.GetInt("LOGIN_MAX_FAILURES", 10),
+				LockoutDuration: time.Duration(env.GetInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+				Window:          time.Hour,
+			},
+			IPLockout: auth.LockoutPolicy{
+				FreeAttempts:    20,
+				BaseDelay:       time.Second,
+				MaxDelay:        time.Minute,
+				Threshold:       env.GetInt("LOGIN_IP_MAX_FAILURES", 100),
+				LockoutDuration: time.Duration(env.GetInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute,
+				Window:          time.Hour,
+			},
 		},
 	}
 
@@ -35,6 +92,10 @@ func main() {
 	logger := zap.Must(zap.NewProduction()).Sugar()
 
 	defer logger.Sync() // flushes buffer, if any
+
+	if cfg.env != "development" && cfg.auth.MFAEncryptionKey == defaultMFAEncryptionKey {
+		logger.Fatalw("MFA_ENCRYPTION_KEY must be set outside development", "environment", cfg.env)
+	}
 	// Db
 
 	db, err := db.New(cfg.db.addr, cfg.db.maxOpenConns, cfg.db.maxIdleConns, cfg.db.maxIdleTime)
@@ -46,11 +107,53 @@ func main() {
 
 	store := store.NewStorage(db)
 
-	jwtMgr := auth.NewManager(cfg.auth.Secret, cfg.auth.Issuer, cfg.auth.Audience)
-	policy := auth.NewDefaultPolicyEngine()
+	jwtMgr, err := newJWTManager(cfg.auth)
+	if err != nil {
+		logger.Fatalw("Failed to initialize token manager", "error", err)
+	}
+	var policy auth.Authorizer = auth.NewDefaultPolicyEngine()
+	if cfg.auth.PolicyFile != "" {
+		policy, err = auth.NewFilePolicy(cfg.auth.PolicyFile)
+		if err != nil {
+			logger.Fatalw("Failed to load policy file", "path", cfg.auth.PolicyFile, "error", err)
+		}
+	}
+
+	var revocations auth.RevocationList = store.RevokedTokens
+	if cfg.auth.RevocationBackend == "memory" {
+		revocations = auth.NewMemoryRevocationList()
+	}
+
+	mailClient, err := mailer.NewFileClient(cfg.mail.dir, cfg.mail.fromEmail, logger)
+	if err != nil {
+		logger.Fatalw("Failed to initialize mailer", "error", err)
+	}
+
+	auditSink, err := newAuditSink(cfg.auth.AuditSinks, logger, store)
+	if err != nil {
+		logger.Fatalw("Failed to initialize audit sink", "error", err)
+	}
+
+	secrets, err := auth.NewSecretBox(cfg.auth.MFAEncryptionKey)
+	if err != nil {
+		logger.Fatalw("Failed to initialize MFA encryption", "error", err)
+	}
+
+	var oidcProviders []auth.OIDCProviderConfig
+	if cfg.auth.OIDCProvidersFile != "" {
+		oidcProviders, err = auth.LoadOIDCProviders(cfg.auth.OIDCProvidersFile)
+		if err != nil {
+			logger.Fatalw("Failed to load OIDC providers", "path", cfg.auth.OIDCProvidersFile, "error", err)
+		}
+	}
+
+	blobs, err := newBlobStore(cfg.media)
+	if err != nil {
+		logger.Fatalw("Failed to initialize blob store", "backend", cfg.media.blobBackend, "error", err)
+	}
 
 	rateLimiter := ratelimiter.NewFixedWindowRateLimiter(10, time.Second)
-	app := application{config: cfg, store: store, logger: logger, jwt: jwtMgr, policy: policy, rateLimiter: rateLimiter}
+	app := application{config: cfg, store: store, logger: logger, jwt: jwtMgr, policy: policy, rateLimiter: rateLimiter, revocations: revocations, mailer: mailClient, audit: auditSink, secrets: secrets, blobs: blobs, oidc: auth.NewOIDCProviders(oidcProviders, &http.Client{Timeout: 10 * time.Second})}
 
 	mux := app.mount()
 	if err := app.run(mux); err != nil {
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/blob"
+	"github.com/yusuf-cirak/social/internal/media"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+type mediaKey string
+
+const mediaCtx mediaKey = "media"
+
+const (
+	// thumbnailSize is the longest side of a generated thumbnail, in pixels.
+	thumbnailSize = 320
+	// multipartOverhead is allowed on top of the upload limit for the
+	// multipart boundaries and part headers.
+	multipartOverhead = 64 << 10
+	// mediaUploadTimeout replaces the server's read timeout for uploads, which
+	// is too short for large files on slow connections.
+	mediaUploadTimeout = 5 * time.Minute
+)
+
+var (
+	errMissingFile  = errors.New(`multipart form has no "file" part`)
+	errFileTooLarge = errors.New("file is too large")
+)
+
+// uploadMediaHandler accepts a multipart/form-data upload with the file in
+// its "file" part. The content type is sniffed from the file itself, and
+// images get a JPEG thumbnail. The returned media can be attached to a post
+// with CreatePostPayload.MediaIDs.
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+	maxBytes := app.config.media.maxUploadBytes
+
+	if err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(mediaUploadTimeout)); err != nil {
+		app.logger.Warnw("could not extend upload read deadline", "error", err)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+
+	tmp, size, err := receiveUpload(r, maxBytes)
+	if tmp != nil {
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, errFileTooLarge), errors.As(err, &maxBytesErr):
+			app.payloadTooLarge(w, r, maxBytes)
+		case errors.Is(err, errMissingFile), errors.Is(err, http.ErrNotMultipart):
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	head := make([]byte, media.SniffLen)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	contentType, err := media.Sniff(head[:n])
+	if err != nil {
+		app.unsupportedMediaType(w, r, err)
+		return
+	}
+
+	prefix := fmt.Sprintf("media/%d/%s", current.ID, rand.Text())
+	m := &store.Media{
+		UserID:      current.ID,
+		Key:         prefix + "/original",
+		ContentType: contentType,
+		SizeBytes:   size,
+	}
+
+	var thumbnail []byte
+	if media.CanThumbnail(contentType) {
+		img, err := media.Thumbnail(tmp, thumbnailSize)
+		if err != nil {
+			// The file starts like an image but doesn't decode as one
+			app.badRequest(w, r, err)
+			return
+		}
+		thumbnailKey := prefix + "/thumbnail"
+		m.ThumbnailKey = &thumbnailKey
+		m.Width, m.Height = &img.Width, &img.Height
+		thumbnail = img.Thumbnail
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.blobs.Put(ctx, m.Key, tmp, size, contentType); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if m.ThumbnailKey != nil {
+		if err := app.blobs.Put(ctx, *m.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			app.deleteMediaBlobs(ctx, m)
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.store.Media.Create(ctx, m); err != nil {
+		app.deleteMediaBlobs(ctx, m)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	setMediaURLs(m)
+	if err := app.jsonResponse(w, http.StatusCreated, m); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// receiveUpload streams the "file" part of a multipart request into a
+// temporary file, which the caller closes and removes. Other parts are
+// skipped.
+func receiveUpload(r *http.Request, maxBytes int64) (*os.File, int64, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, 0, errMissingFile
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		tmp, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		size, err := io.Copy(tmp, io.LimitReader(part, maxBytes+1))
+		if err != nil {
+			return tmp, 0, err
+		}
+		if size > maxBytes {
+			return tmp, 0, errFileTooLarge
+		}
+		return tmp, size, nil
+	}
+}
+
+// deleteMediaBlobs removes the blobs of an upload that could not be saved.
+func (app *application) deleteMediaBlobs(ctx context.Context, m *store.Media) {
+	keys := []string{m.Key}
+	if m.ThumbnailKey != nil {
+		keys = append(keys, *m.ThumbnailKey)
+	}
+	for _, key := range keys {
+		if err := app.blobs.Delete(ctx, key); err != nil {
+			app.logger.Errorw("failed to delete media blob", "key", key, "error", err)
+		}
+	}
+}
+
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	m := getMediaFromCtx(r)
+	setMediaURLs(m)
+
+	if err := app.jsonResponse(w, http.StatusOK, m); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getMediaContentHandler(w http.ResponseWriter, r *http.Request) {
+	m := getMediaFromCtx(r)
+	app.serveBlob(w, r, m.Key, m.ContentType)
+}
+
+func (app *application) getMediaThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	m := getMediaFromCtx(r)
+	if m.ThumbnailKey == nil {
+		app.notFound(w, r, errors.New("media has no thumbnail"))
+		return
+	}
+	app.serveBlob(w, r, *m.ThumbnailKey, "image/jpeg")
+}
+
+func (app *application) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType string) {
+	rc, err := app.blobs.Open(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blob.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if _, err := io.Copy(w, rc); err != nil {
+		// The status has been sent already; all that's left is to log
+		app.logger.Warnw("failed to send media", "key", key, "error", err)
+	}
+}
+
+// mediaContextMiddleware loads the media in the URL. Media is visible to its
+// uploader, and to everyone else once it is attached to a published post.
+func (app *application) mediaContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		m, err := app.store.Media.GetByID(ctx, id)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		if current := getCurrentUser(ctx); current == nil || current.ID != m.UserID {
+			visible, err := app.mediaVisible(ctx, m)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !visible {
+				app.notFound(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
+		ctx = context.WithValue(ctx, mediaCtx, m)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// mediaVisible reports whether m is attached to a published post that is not
+// in the trash.
+func (app *application) mediaVisible(ctx context.Context, m *store.Media) (bool, error) {
+	if m.PostID == nil {
+		return false, nil
+	}
+
+	post, err := app.store.Posts.GetByID(ctx, *m.PostID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return post.Status == store.PostPublished, nil
+}
+
+func getMediaFromCtx(r *http.Request) *store.Media {
+	m, ok := r.Context().Value(mediaCtx).(*store.Media)
+	if !ok {
+		return nil
+	}
+	return m
+}
+
+// loadPostMedia fills in the media attached to posts.
+func (app *application) loadPostMedia(ctx context.Context, posts ...*store.Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	attached, err := app.store.Media.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Media = attached[p.ID]
+		setMediaURLs(p.Media...)
+	}
+	return nil
+}
+
+// setMediaURLs points media at the endpoints serving their content.
+func setMediaURLs(media ...*store.Media) {
+	for _, m := range media {
+		m.URL = fmt.Sprintf("/v1/media/%d/content", m.ID)
+		if m.ThumbnailKey != nil {
+			m.ThumbnailURL = fmt.Sprintf("/v1/media/%d/thumbnail", m.ID)
+		}
+	}
+}
+
+// purgeOrphanedMedia removes media that was never attached to a post, or
+// whose post was purged, together with its blobs.
+func (app *application) purgeOrphanedMedia(ctx context.Context) error {
+	for ctx.Err() == nil {
+		purged, err := app.store.Media.PurgeOrphans(ctx, orphanedMediaAge, orphanedMediaBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, m := range purged {
+			app.deleteMediaBlobs(ctx, m)
+		}
+		if len(purged) < orphanedMediaBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// newBlobStore builds the store uploads are kept in.
+func newBlobStore(cfg mediaConfig) (blob.Store, error) {
+	switch cfg.blobBackend {
+	case "fs":
+		return blob.NewFileStore(cfg.blobDir)
+	case "s3":
+		return blob.NewS3Store(cfg.s3, &http.Client{Timeout: mediaUploadTimeout})
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.blobBackend)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+
+	"github.com/yusuf-cirak/social/internal/mention"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+// resolveMentions finds the @usernames in content written by authorID and
+// returns those that refer to users the author can mention. Mentions of
+// users who don't exist or who blocked the author stay plain text.
+func (app *application) resolveMentions(ctx context.Context, authorID int64, content string) ([]store.Mention, error) {
+	matches := mention.Find(content)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	users, err := app.store.Users.GetMentionable(ctx, authorID, mention.Usernames(matches))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64, len(users))
+	for _, u := range users {
+		ids[u.Username] = u.ID
+	}
+
+	var mentions []store.Mention
+	for _, m := range matches {
+		if id, ok := ids[m.Username]; ok {
+			mentions = append(mentions, store.Mention{UserID: id, Username: m.Username, Start: m.Start, End: m.End})
+		}
+	}
+	return mentions, nil
+}
+
+// loadPostMentions fills in the mentions in the content of posts.
+func (app *application) loadPostMentions(ctx context.Context, posts ...*store.Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	mentions, err := app.store.Mentions.GetByPostIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Entities.Mentions = mentions[p.ID]
+	}
+	return nil
+}
+
+// loadCommentMentions fills in the mentions in comments and their loaded
+// replies.
+func (app *application) loadCommentMentions(ctx context.Context, comments []store.Comment) error {
+	var ids []int64
+	var collect func([]store.Comment)
+	collect = func(comments []store.Comment) {
+		for _, c := range comments {
+			ids = append(ids, c.ID)
+			collect(c.Replies)
+		}
+	}
+	collect(comments)
+
+	mentions, err := app.store.Mentions.GetByCommentIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var fill func([]store.Comment)
+	fill = func(comments []store.Comment) {
+		for i := range comments {
+			comments[i].Entities.Mentions = mentions[comments[i].ID]
+			fill(comments[i].Replies)
+		}
+	}
+	fill(comments)
+
+	return nil
+}
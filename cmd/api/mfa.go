@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+// recoveryCodeCount is the number of one-time recovery codes handed out when
+// two-factor authentication is enabled.
+const recoveryCodeCount = 10
+
+type totpEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// enrollTOTPHandler generates a TOTP secret for the current user. It is not
+// used for logins until it is confirmed with enableTOTPHandler.
+func (app *application) enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r.Context())
+
+	secret, err := iauth.NewTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	sealed, err := app.secrets.Seal([]byte(secret))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.MFA.SavePending(r.Context(), user.ID, sealed); err != nil {
+		switch {
+		case errors.Is(err, store.ErrMFAEnabled):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	resp := totpEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: iauth.TOTPProvisioningURI(app.config.auth.Issuer, user.Email, secret),
+	}
+	if err := app.jsonResponse(w, http.StatusCreated, resp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type EnableTOTPPayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// enableTOTPHandler confirms a pending enrollment with a code from the
+// authenticator app and returns the recovery codes. They are only shown once.
+func (app *application) enableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload EnableTOTPPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getCurrentUser(ctx)
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if mfa.Enabled {
+		app.conflictResponse(w, r, store.ErrMFAEnabled)
+		return
+	}
+
+	secret, err := app.secrets.Open(mfa.Secret)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	step, ok := iauth.ValidateTOTP(string(secret), payload.Code, time.Now())
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	codes, err := iauth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	hashes := make([][]byte, len(codes))
+	for i, code := range codes {
+		hashes[i] = iauth.HashOpaqueToken(code)
+	}
+
+	if err := app.store.MFA.Enable(ctx, user.ID, step, hashes); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			// Enabled by a concurrent request
+			app.conflictResponse(w, r, store.ErrMFAEnabled)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type SecondFactorPayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+// disableTOTPHandler turns off two-factor authentication. A current code or
+// an unused recovery code is required.
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SecondFactorPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getCurrentUser(ctx)
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if mfa.Enabled {
+		ok, err := app.verifySecondFactor(r, mfa, payload)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !ok {
+			writeJSONError(w, http.StatusUnauthorized, "invalid code")
+			return
+		}
+	}
+
+	if err := app.store.MFA.Disable(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type mfaChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// mfaChallenge answers a login whose password was correct but which still
+// needs a second factor. The mfa_token can only be exchanged at /auth/mfa/verify.
+func (app *application) mfaChallenge(w http.ResponseWriter, r *http.Request, user *store.User) {
+	token, err := app.jwt.GenerateToken(user.ID, user.Username, app.config.auth.MFAPendingTTL, iauth.WithPurpose(iauth.PurposeMFAPending))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusOK, mfaChallengeResponse{MFARequired: true, MFAToken: token})
+}
+
+type VerifyMFALoginPayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	SecondFactorPayload
+}
+
+// verifyMFALoginHandler completes a login started by loginHandler. The
+// mfa_token is single use.
+func (app *application) verifyMFALoginHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMFALoginPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	claims, err := app.jwt.ParseAndValidatePurpose(payload.MFAToken, iauth.PurposeMFAPending)
+	if err != nil || claims.ID == "" {
+		writeJSONError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+
+	revoked, err := app.revocations.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if revoked {
+		writeJSONError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+
+	user, err := app.store.Users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeJSONError(w, http.StatusUnauthorized, "user not found")
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.IsActive {
+		writeJSONError(w, http.StatusForbidden, "account is not activated")
+		return
+	}
+
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		// Disabled since the password step
+		writeJSONError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	case !mfa.Enabled:
+		writeJSONError(w, http.StatusUnauthorized, "invalid or expired token")
+		return
+	}
+
+	// Guessing codes counts against the same limits as guessing passwords
+	if app.loginLocked(w, r, user.Email) {
+		return
+	}
+
+	ok, err := app.verifySecondFactor(r, mfa, payload.SecondFactorPayload)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !ok {
+		if err := app.recordLoginFailure(r, user.Email, user); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		writeJSONError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	if err := app.store.LoginFailures.Reset(ctx, accountLoginKey(user.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.revocations.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens, err := app.startSession(r, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusOK, tokens)
+}
+
+// verifySecondFactor checks a TOTP code or consumes a recovery code. A TOTP
+// code is rejected if its time step was already used.
+func (app *application) verifySecondFactor(r *http.Request, mfa *store.MFA, payload SecondFactorPayload) (bool, error) {
+	ctx := r.Context()
+
+	if payload.Code == "" {
+		err := app.store.MFA.UseRecoveryCode(ctx, mfa.UserID, iauth.HashOpaqueToken(iauth.NormalizeRecoveryCode(payload.RecoveryCode)))
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+		return true, nil
+	}
+
+	secret, err := app.secrets.Open(mfa.Secret)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := iauth.ValidateTOTP(string(secret), payload.Code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	err = app.store.MFA.UseStep(ctx, mfa.UserID, step)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+var defaultNotificationQuery = store.PaginatedNotificationQuery{
+	Limit: 20,
+}
+
+// getNotificationsHandler lists the current user's notifications, newest
+// first. ?unread=true leaves out those that were marked as read.
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	nq, err := defaultNotificationQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(nq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	page, err := app.store.Notifications.GetByUserID(ctx, getCurrentUser(ctx).ID, nq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// readNotificationsHandler marks all of the current user's notifications as
+// read.
+func (app *application) readNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := app.store.Notifications.MarkAllRead(ctx, getCurrentUser(ctx).ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
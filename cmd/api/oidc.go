@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/mention"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+const (
+	// oidcLoginStateTTL bounds how long a user may take at the identity provider.
+	oidcLoginStateTTL = 10 * time.Minute
+	// maxUsernameAttempts is how often a generated username is retried with a
+	// random suffix before giving up.
+	maxUsernameAttempts = 3
+)
+
+// oidcLoginHandler starts the authorization code flow by redirecting to the
+// identity provider. The PKCE verifier and nonce stay on the server.
+func (app *application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := app.oidc.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		app.notFound(w, r, err)
+		return
+	}
+
+	state, stateHash, err := iauth.NewOpaqueToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nonce, err := iauth.NewID()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	verifier, err := iauth.NewPKCEVerifier()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	redirectURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	loginState := &store.OIDCLoginState{
+		StateHash:    stateHash,
+		Provider:     provider.Name(),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	}
+	if err := app.store.Identities.SaveLoginState(r.Context(), loginState); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// oidcCallbackHandler finishes the flow started by oidcLoginHandler and signs
+// the user in, linking or creating an account as needed.
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, err := app.oidc.Get(chi.URLParam(r, "provider"))
+	if err != nil {
+		app.notFound(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		app.logger.Warnw("Identity provider returned an error", "provider", provider.Name(), "error", query.Get("error"), "description", query.Get("error_description"))
+		writeJSONError(w, http.StatusUnauthorized, "login was not completed")
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		app.badRequest(w, r, errors.New("code and state are required"))
+		return
+	}
+
+	ctx := r.Context()
+
+	loginState, err := app.store.Identities.ConsumeLoginState(ctx, provider.Name(), iauth.HashOpaqueToken(state))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeJSONError(w, http.StatusUnauthorized, "invalid or expired login state")
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		app.logger.Warnw("OIDC code exchange failed", "provider", provider.Name(), "error", err)
+		writeJSONError(w, http.StatusUnauthorized, "login was not completed")
+		return
+	}
+
+	user, err := app.userForIdentity(r, identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailNotVerified):
+			writeJSONError(w, http.StatusUnauthorized, err.Error())
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if !user.IsActive {
+		writeJSONError(w, http.StatusForbidden, "account is not activated")
+		return
+	}
+
+	// A second factor is still required for accounts that enabled it
+	mfa, err := app.store.MFA.GetByUserID(ctx, user.ID)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	case mfa.Enabled:
+		app.mfaChallenge(w, r, user)
+		return
+	}
+
+	tokens, err := app.startSession(r, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	_ = app.jsonResponse(w, http.StatusOK, tokens)
+}
+
+var errEmailNotVerified = errors.New("email is not verified by the identity provider")
+
+// userForIdentity returns the user linked to an external identity. Unknown
+// identities are linked to the user with the same verified email, or get a new
+// account when there is none.
+func (app *application) userForIdentity(r *http.Request, identity *iauth.OIDCIdentity) (*store.User, error) {
+	ctx := r.Context()
+
+	userID, err := app.store.Identities.GetUserID(ctx, identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		return app.store.Users.GetByID(ctx, userID)
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+
+	link := &store.Identity{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email}
+
+	user, err := app.store.Users.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		link.UserID = user.ID
+		if err := app.store.Identities.Link(ctx, link); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+
+	return app.createUserForIdentity(r, identity, link)
+}
+
+// createUserForIdentity creates an account for a new external identity. The
+// password is random; the user can set one through the password reset flow.
+func (app *application) createUserForIdentity(r *http.Request, identity *iauth.OIDCIdentity, link *store.Identity) (*store.User, error) {
+	password, _, err := iauth.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Usernames follow the same rule as at registration, leaving room for the
+	// suffix added when one is taken
+	base := mention.SanitizeUsername(identity.PreferredUsername, mention.MaxUsernameLen-7)
+	if base == "" {
+		local, _, _ := strings.Cut(identity.Email, "@")
+		base = mention.SanitizeUsername(local, mention.MaxUsernameLen-7)
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	username := base
+	for attempt := 1; ; attempt++ {
+		user := &store.User{Username: username, Email: identity.Email}
+		if err := user.Password.Set(password); err != nil {
+			return nil, err
+		}
+
+		err := app.store.Identities.CreateUser(r.Context(), user, link)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, store.ErrDuplicateUsername) || attempt == maxUsernameAttempts {
+			return nil, err
+		}
+
+		suffix, err := iauth.NewID()
+		if err != nil {
+			return nil, err
+		}
+		username = base + "_" + suffix[:6]
+	}
+}
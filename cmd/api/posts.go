@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/yusuf-cirak/social/internal/store"
@@ -18,6 +20,13 @@ type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
 	Tags    []string `json:"tags" validate:"required,dive,required,max=100"`
+	// Status defaults to published. Scheduled posts need PublishAt.
+	Status    *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
+	// QuotedPostID makes the post a quote of another published post.
+	QuotedPostID *int64 `json:"quoted_post_id" validate:"omitempty,gt=0"`
+	// MediaIDs attaches media uploaded with POST /v1/media, in this order.
+	MediaIDs []int64 `json:"media_ids" validate:"max=4,unique,dive,gt=0"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,10 +54,58 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		Version: 1,
 	}
 
-	if err := app.store.Posts.Create(ctx, post); err != nil {
+	if err := schedulePost(post, payload.Status, payload.PublishAt); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if payload.QuotedPostID != nil {
+		quoted, err := app.store.Posts.GetByID(ctx, *payload.QuotedPostID)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.badRequest(w, r, errors.New("quoted post not found"))
+			return
+		case err != nil:
+			app.internalServerError(w, r, err)
+			return
+		case quoted.Status != store.PostPublished:
+			app.badRequest(w, r, errors.New("quoted post not found"))
+			return
+		}
+		post.QuotedPostID = &quoted.ID
+	}
+
+	for _, id := range payload.MediaIDs {
+		post.Media = append(post.Media, &store.Media{ID: id})
+	}
+
+	mentions, err := app.resolveMentions(ctx, current.ID, post.Content)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	post.Entities.Mentions = mentions
+
+	if err := app.store.Posts.Create(ctx, post); err != nil {
+		switch {
+		case errors.Is(err, store.ErrMediaUnavailable):
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	setMediaURLs(post.Media...)
+
+	if post.QuotedPostID != nil {
+		// Reloaded for the summary of the quoted post and its author
+		created, err := app.store.Posts.GetByID(ctx, post.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		post.QuotedPost = created.QuotedPost
+	}
 
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
@@ -60,20 +117,96 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 
 	post := getPostFromCtx(r)
 
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	// Only the newest comments are embedded; the rest are paged through
+	// /posts/{postID}/comments
+	page, err := app.store.Comments.GetByPostID(r.Context(), post.ID, defaultCommentQuery)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	post.Comments = comments
+	post.Comments = page.Comments
+
+	if err := app.loadPostReactions(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMedia(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMentions(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadCommentMentions(r.Context(), post.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
+	if err := app.loadCommentReactions(r.Context(), post.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post))
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// defaultUnpublishedQuery is used when a request doesn't page through drafts itself.
+var defaultUnpublishedQuery = store.PaginatedUnpublishedQuery{
+	Limit: 20,
+}
+
+// getUnpublishedPostsHandler lists the current user's drafts and scheduled
+// posts, newest first. ?status= narrows it to draft or scheduled.
+func (app *application) getUnpublishedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	uq, err := defaultUnpublishedQuery.Parse(r)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(uq); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	page, err := app.store.Posts.GetUnpublished(ctx, getCurrentUser(ctx).ID, uq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequest(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loadPostMentions(ctx, page.Posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.loadPostMedia(ctx, page.Posts...); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
@@ -86,7 +219,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.store.Posts.Delete(ctx, id)
+	err = app.store.Posts.Delete(ctx, id, getCurrentUser(ctx).ID)
 
 	if err != nil {
 		switch {
@@ -103,10 +236,20 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title     *string    `json:"title" validate:"omitempty,max=100"`
+	Content   *string    `json:"content" validate:"omitempty,max=1000"`
+	Status    *string    `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
+// updatePostHandler requires an If-Match header with the ETag from
+// getPostHandler, so that concurrent edits don't overwrite each other.
+//
+// Post ETags are weak, because the GET body also carries comments and
+// reactions that change without the post's version changing. If-Match
+// deliberately compares only the version, so W/"3" and "3" both match version
+// 3; this is a weak comparison where RFC 9110 asks for a strong one, and is
+// what the version check in the store actually guarantees.
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 
 	var payload UpdatePostPayload
@@ -126,6 +269,17 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeJSONError(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return
+	}
+
+	if !etagMatches(ifMatch, post) {
+		app.preconditionFailed(w, r, post.Version)
+		return
+	}
+
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
@@ -133,15 +287,118 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Content = *payload.Content
 	}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+	if err := schedulePost(post, payload.Status, payload.PublishAt); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	app.savePostEdit(w, r, post)
+}
+
+// schedulePost moves post to status, keeping its current status when status
+// is nil. Scheduled posts need a publishAt in the future, unless they keep
+// the time they were scheduled for. Published posts stay published.
+func schedulePost(post *store.Post, status *string, publishAt *time.Time) error {
+	next := post.Status
+	if status != nil {
+		next = *status
+	}
+	if next == "" {
+		next = store.PostPublished
+	}
+
+	if post.Status == store.PostPublished && next != store.PostPublished {
+		return errors.New("a published post can't become a draft or be scheduled")
+	}
+
+	switch next {
+	case store.PostScheduled:
+		if publishAt != nil {
+			if !publishAt.After(time.Now()) {
+				return errors.New("publish_at must be in the future")
+			}
+			post.PublishAt = publishAt
+		} else if post.Status != store.PostScheduled {
+			return errors.New("publish_at is required to schedule a post")
+		}
+	default:
+		if publishAt != nil {
+			return errors.New("publish_at is only allowed for scheduled posts")
+		}
+		if next == store.PostDraft {
+			post.PublishAt = nil
+		}
+	}
+
+	post.Status = next
+	return nil
+}
+
+// savePostEdit saves an edited post as the current user and responds with it.
+// The edit is rejected if the post changed since it was loaded.
+func (app *application) savePostEdit(w http.ResponseWriter, r *http.Request, post *store.Post) {
+	ctx := r.Context()
+
+	// Mentions belong to the author, whoever edits the post
+	mentions, err := app.resolveMentions(ctx, post.UserID, post.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	post.Entities.Mentions = mentions
+
+	if err := app.store.Posts.Update(ctx, post, getCurrentUser(ctx).ID); err != nil {
 		switch {
 		case errors.Is(err, store.ErrNotFound):
 			app.notFound(w, r, err)
+		case errors.Is(err, store.ErrEditConflict):
+			// Someone else saved the post since it was loaded for this request
+			current, err := app.store.Posts.GetByID(ctx, post.ID)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				// ...or deleted it
+				app.notFound(w, r, err)
+			case err != nil:
+				app.internalServerError(w, r, err)
+			default:
+				app.preconditionFailed(w, r, current.Version)
+			}
 		default:
 			app.internalServerError(w, r, err)
 		}
 		return
 	}
+
+	w.Header().Set("ETag", postETag(post))
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// postETag is a weak validator naming the post's version. It is weak because
+// responses also carry comments, reactions and media, which change without
+// the version changing.
+func postETag(post *store.Post) string {
+	return versionETag(post.Version)
+}
+
+func versionETag(version int) string {
+	return `W/"` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches reports whether an If-Match header names the post's current
+// version. Only the version is compared, so weak and strong forms of the same
+// tag both match; see updatePostHandler.
+func etagMatches(header string, post *store.Post) bool {
+	current := strings.TrimPrefix(postETag(post), "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
 }
 
 func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
@@ -166,6 +423,14 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Drafts and scheduled posts don't exist for anyone but their author
+		if post.Status != store.PostPublished {
+			if current := getCurrentUser(ctx); current == nil || current.ID != post.UserID {
+				app.notFound(w, r, store.ErrNotFound)
+				return
+			}
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusuf-cirak/social/internal/store"
+	"go.uber.org/zap"
+)
+
+type fakePostStore struct {
+	unpublished *store.PostPage
+	// userID and query are the last arguments passed to GetUnpublished.
+	userID int64
+	query  store.PaginatedUnpublishedQuery
+}
+
+func (s *fakePostStore) GetUnpublished(_ context.Context, userID int64, uq store.PaginatedUnpublishedQuery) (*store.PostPage, error) {
+	s.userID, s.query = userID, uq
+	return s.unpublished, nil
+}
+
+func (s *fakePostStore) Create(context.Context, *store.Post) error { return nil }
+func (s *fakePostStore) GetByID(context.Context, int64) (*store.Post, error) {
+	return nil, store.ErrNotFound
+}
+func (s *fakePostStore) GetUserFeed(context.Context, int64, store.PaginatedFeedQuery) ([]*store.PostWithMetadata, error) {
+	return nil, nil
+}
+func (s *fakePostStore) Update(context.Context, *store.Post, int64) error { return nil }
+func (s *fakePostStore) Delete(context.Context, int64, int64) error       { return nil }
+func (s *fakePostStore) GetTrash(context.Context, int64, time.Duration) ([]*store.Post, error) {
+	return nil, nil
+}
+func (s *fakePostStore) GetDeleted(context.Context, int64, time.Duration) (*store.Post, error) {
+	return nil, store.ErrNotFound
+}
+func (s *fakePostStore) Restore(context.Context, int64, time.Duration) (*store.Post, error) {
+	return nil, store.ErrNotFound
+}
+func (s *fakePostStore) PublishDue(context.Context, int) (int, error)      { return 0, nil }
+func (s *fakePostStore) PurgeDeleted(context.Context, time.Duration) error { return nil }
+
+type fakeMediaStore struct{}
+
+func (fakeMediaStore) Create(context.Context, *store.Media) error { return nil }
+func (fakeMediaStore) GetByID(context.Context, int64) (*store.Media, error) {
+	return nil, store.ErrNotFound
+}
+func (fakeMediaStore) GetByPostIDs(context.Context, []int64) (map[int64][]*store.Media, error) {
+	return nil, nil
+}
+func (fakeMediaStore) PurgeOrphans(context.Context, time.Duration, int) ([]*store.Media, error) {
+	return nil, nil
+}
+
+func TestPostETag(t *testing.T) {
+	assert.Equal(t, `W/"3"`, postETag(&store.Post{Version: 3}))
+}
+
+func TestETagMatches(t *testing.T) {
+	post := &store.Post{Version: 3}
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`W/"3"`, true},
+		{`"3"`, true},
+		{`*`, true},
+		{`"1", W/"3"`, true},
+		{`W/"2"`, false},
+		{`3`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.header, post))
+		})
+	}
+}
+
+func TestGetUnpublishedPostsHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		want   int
+		status string
+	}{
+		{"all", "", http.StatusOK, ""},
+		{"drafts", "?status=draft", http.StatusOK, store.PostDraft},
+		{"scheduled", "?status=scheduled", http.StatusOK, store.PostScheduled},
+		{"published", "?status=published", http.StatusBadRequest, ""},
+		{"too many", "?limit=500", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts := &fakePostStore{unpublished: &store.PostPage{Posts: []*store.Post{{ID: 3, UserID: 7, Status: store.PostDraft}}}}
+			app := &application{
+				store: store.Storage{
+					Posts:    posts,
+					Media:    fakeMediaStore{},
+					Mentions: fakeMentionStore{},
+				},
+				logger: zap.NewNop().Sugar(),
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/v1/users/me/posts"+tt.query, nil)
+			r = r.WithContext(context.WithValue(r.Context(), currentUserCtxKey, &store.User{ID: 7}))
+			w := httptest.NewRecorder()
+			app.getUnpublishedPostsHandler(w, r)
+
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+			if tt.want == http.StatusOK {
+				assert.Equal(t, int64(7), posts.userID)
+				assert.Equal(t, tt.status, posts.query.Status)
+				assert.Contains(t, w.Body.String(), `"posts":[{"id":3`)
+			}
+		})
+	}
+}
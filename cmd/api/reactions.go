@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+func (app *application) putPostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.setReaction(w, r, store.ReactionTargetPost, getPostFromCtx(r).ID, true)
+}
+
+func (app *application) deletePostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.setReaction(w, r, store.ReactionTargetPost, getPostFromCtx(r).ID, false)
+}
+
+func (app *application) putCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.setReaction(w, r, store.ReactionTargetComment, getCommentFromCtx(r).ID, true)
+}
+
+func (app *application) deleteCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.setReaction(w, r, store.ReactionTargetComment, getCommentFromCtx(r).ID, false)
+}
+
+// setReaction adds or removes the current user's reaction of the kind in the
+// URL and responds with the target's updated reactions. Repeating a request
+// has no further effect.
+func (app *application) setReaction(w http.ResponseWriter, r *http.Request, targetType string, targetID int64, add bool) {
+	kind := chi.URLParam(r, "kind")
+	if !slices.Contains(store.ReactionKinds, kind) {
+		app.badRequest(w, r, fmt.Errorf("unknown reaction kind %q", kind))
+		return
+	}
+
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+
+	reaction := &store.Reaction{
+		UserID:     current.ID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Kind:       kind,
+	}
+
+	update := app.store.Reactions.Remove
+	if add {
+		update = app.store.Reactions.Add
+	}
+	if err := update(ctx, reaction); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	summaries, err := app.store.Reactions.Summarize(ctx, targetType, []int64{targetID}, current.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, summaries[targetID]); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// viewerID returns the ID of the current user, or 0 for anonymous requests.
+func viewerID(ctx context.Context) int64 {
+	if user := getCurrentUser(ctx); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// loadPostReactions fills in the reactions of posts as seen by the current
+// user.
+func (app *application) loadPostReactions(ctx context.Context, posts ...*store.Post) error {
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	summaries, err := app.store.Reactions.Summarize(ctx, store.ReactionTargetPost, ids, viewerID(ctx))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range posts {
+		p.Reactions = summaries[p.ID]
+	}
+	return nil
+}
+
+// loadCommentReactions fills in the reactions of comments and their loaded
+// replies as seen by the current user.
+func (app *application) loadCommentReactions(ctx context.Context, comments []store.Comment) error {
+	var ids []int64
+	var collect func([]store.Comment)
+	collect = func(comments []store.Comment) {
+		for _, c := range comments {
+			ids = append(ids, c.ID)
+			collect(c.Replies)
+		}
+	}
+	collect(comments)
+
+	summaries, err := app.store.Reactions.Summarize(ctx, store.ReactionTargetComment, ids, viewerID(ctx))
+	if err != nil {
+		return err
+	}
+
+	var fill func([]store.Comment)
+	fill = func(comments []store.Comment) {
+		for i := range comments {
+			comments[i].Reactions = summaries[comments[i].ID]
+			fill(comments[i].Replies)
+		}
+	}
+	fill(comments)
+
+	return nil
+}
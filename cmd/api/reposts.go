@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+// repostHandler shares a post with the current user's followers. Reposting a
+// post again has no further effect.
+func (app *application) repostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	post := getPostFromCtx(r)
+
+	if post.Status != store.PostPublished {
+		app.conflictResponse(w, r, errors.New("only published posts can be reposted"))
+		return
+	}
+
+	if err := app.store.Reposts.Add(ctx, getCurrentUser(ctx).ID, post.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) undoRepostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := app.store.Reposts.Remove(ctx, getCurrentUser(ctx).ID, getPostFromCtx(r).ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
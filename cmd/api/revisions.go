@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/diff"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+func (app *application) getRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.PostRevisions.GetByPostID(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, revisions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type revisionDiff struct {
+	From    int         `json:"from"`
+	To      int         `json:"to"`
+	Title   []diff.Line `json:"title"`
+	Content []diff.Line `json:"content"`
+}
+
+// getRevisionDiffHandler compares two versions of a post line by line. to
+// defaults to the current version.
+func (app *application) getRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	query := r.URL.Query()
+
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil {
+		app.badRequest(w, r, fmt.Errorf("invalid from version: %w", err))
+		return
+	}
+
+	to := post.Version
+	if v := query.Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			app.badRequest(w, r, fmt.Errorf("invalid to version: %w", err))
+			return
+		}
+	}
+
+	ctx := r.Context()
+
+	old, err := app.postAtVersion(ctx, post, from)
+	if err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	updated, err := app.postAtVersion(ctx, post, to)
+	if err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	result := revisionDiff{
+		From:    from,
+		To:      to,
+		Title:   diff.Lines(old.Title, updated.Title),
+		Content: diff.Lines(old.Content, updated.Content),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, result); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// restoreRevisionHandler makes an earlier version of a post current again. The
+// restore is saved as a new edit, so the version it replaces stays in the
+// history. Like updatePostHandler, it requires an If-Match header with the
+// post's current ETag, compared by version only.
+func (app *application) restoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeJSONError(w, http.StatusPreconditionRequired, "If-Match header is required")
+		return
+	}
+
+	if !etagMatches(ifMatch, post) {
+		app.preconditionFailed(w, r, post.Version)
+		return
+	}
+
+	revision, err := app.store.PostRevisions.GetByVersion(r.Context(), post.ID, version)
+	if err != nil {
+		app.revisionError(w, r, err)
+		return
+	}
+
+	post.Title = revision.Title
+	post.Content = revision.Content
+
+	app.savePostEdit(w, r, post)
+}
+
+// postAtVersion returns the title and content of a post at version, which is
+// either the current version or a saved revision.
+func (app *application) postAtVersion(ctx context.Context, post *store.Post, version int) (*store.PostRevision, error) {
+	if version == post.Version {
+		return &store.PostRevision{PostID: post.ID, Version: post.Version, Title: post.Title, Content: post.Content}, nil
+	}
+	return app.store.PostRevisions.GetByVersion(ctx, post.ID, version)
+}
+
+func (app *application) revisionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.notFound(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
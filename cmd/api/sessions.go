@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+const (
+	// sessionTouchInterval is how stale a session's last-seen time may get
+	// before a request updates it.
+	sessionTouchInterval = time.Minute
+	maxUserAgentLength   = 512
+)
+
+type sessionResponse struct {
+	*store.Session
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// getSessionsHandler lists the devices the current user is signed in on.
+func (app *application) getSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+	claims := getCurrentClaims(ctx)
+
+	sessions, err := app.store.Sessions.GetActiveByUserID(ctx, current.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	resp := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		resp[i] = sessionResponse{Session: session, Current: session.ID == claims.SessionID}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, resp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteSessionHandler signs the current user out of one device. Its tokens
+// stop working right away.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	current := getCurrentUser(r.Context())
+
+	if err := app.store.Sessions.Revoke(r.Context(), current.ID, chi.URLParam(r, "sessionID")); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+type CreatePersonalAccessTokenPayload struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,scope"`
+	ExpiresInDays *int     `json:"expires_in_days" validate:"omitempty,gte=1,lte=365"`
+}
+
+type createdPersonalAccessToken struct {
+	*store.PersonalAccessToken
+	// Token is only returned once, when the token is created.
+	Token string `json:"token"`
+}
+
+func (app *application) createPersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreatePersonalAccessTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	current := getCurrentUser(ctx)
+
+	token, hash, err := iauth.NewPersonalAccessToken()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	pat := &store.PersonalAccessToken{
+		UserID:    current.ID,
+		Name:      payload.Name,
+		Scopes:    payload.Scopes,
+		TokenHash: hash,
+	}
+
+	if payload.ExpiresInDays != nil {
+		expiresAt := time.Now().AddDate(0, 0, *payload.ExpiresInDays)
+		pat.ExpiresAt = &expiresAt
+	}
+
+	if err := app.store.PersonalAccessTokens.Create(ctx, pat); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, createdPersonalAccessToken{PersonalAccessToken: pat, Token: token}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	current := getCurrentUser(r.Context())
+
+	tokens, err := app.store.PersonalAccessTokens.GetByUserID(r.Context(), current.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) deletePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	current := getCurrentUser(r.Context())
+
+	if err := app.store.PersonalAccessTokens.Delete(r.Context(), current.ID, tokenID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
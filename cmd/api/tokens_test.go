@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
+)
+
+func TestCreatePersonalAccessTokenPayload_Scopes(t *testing.T) {
+	// Every scope the auth package knows can be granted
+	assert.NoError(t, Validate.Struct(CreatePersonalAccessTokenPayload{Name: "ci", Scopes: iauth.Scopes}))
+
+	for _, scopes := range [][]string{nil, {}, {"posts:read"}, {iauth.ScopePostsWrite, "admin"}} {
+		assert.Error(t, Validate.Struct(CreatePersonalAccessTokenPayload{Name: "ci", Scopes: scopes}), "%v", scopes)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/yusuf-cirak/social/internal/store"
+)
+
+// getTrashHandler lists the current user's deleted posts that can still be
+// restored.
+func (app *application) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	posts, err := app.store.Posts.GetTrash(ctx, getCurrentUser(ctx).ID, app.config.posts.trashRetention)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// restorePostHandler takes a post out of the trash. Authors can undo their
+// own deletions; moderators can restore any post.
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	post, err := app.store.Posts.Restore(r.Context(), getPostFromCtx(r).ID, app.config.posts.trashRetention)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// trashedPostContextMiddleware loads the deleted post in the URL. Only posts
+// that can still be restored are found.
+func (app *application) trashedPostContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		post, err := app.store.Posts.GetDeleted(ctx, id, app.config.posts.trashRetention)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFound(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, postCtx, post)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	iauth "github.com/yusuf-cirak/social/internal/auth"
 	"github.com/yusuf-cirak/social/internal/store"
 )
 
@@ -65,6 +67,24 @@ func (app *application) unFollowUserHandler(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// activateUserHandler activates the account that was sent the given invitation token.
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	err := app.store.Users.Activate(r.Context(), iauth.HashOpaqueToken(token))
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFound(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
@@ -84,8 +104,8 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 				app.notFound(w, r, err)
 			default:
 				app.internalServerError(w, r, err)
-				return
 			}
+			return
 		}
 
 		ctx = context.WithValue(ctx, userCtxKey, user)
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash bytea UNIQUE NOT NULL,
+    family_id varchar(64) NOT NULL,
+    expires_at timestamp(0) with time zone NOT NULL,
+    revoked_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+
+create index if not exists idx_refresh_tokens_family_id on refresh_tokens (family_id);
+create index if not exists idx_refresh_tokens_user_id on refresh_tokens (user_id);
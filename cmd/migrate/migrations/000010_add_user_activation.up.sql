@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN is_active boolean NOT NULL DEFAULT false;
+
+-- Accounts created before activation existed are considered confirmed
+UPDATE users SET is_active = true;
+
+CREATE TABLE IF NOT EXISTS user_invitations (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+create index if not exists idx_user_invitations_user_id on user_invitations (user_id);
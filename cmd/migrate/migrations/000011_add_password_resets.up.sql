@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN password_changed_at timestamp with time zone;
+
+CREATE TABLE IF NOT EXISTS password_resets (
+    token bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+create index if not exists idx_password_resets_user_id on password_resets (user_id);
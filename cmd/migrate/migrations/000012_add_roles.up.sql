@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name varchar(50) PRIMARY KEY,
+    description text NOT NULL
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'A regular user who can create posts and comments'),
+    ('moderator', 'A moderator who can remove other users'' content'),
+    ('admin', 'An administrator with full access')
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role varchar(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (user_id, role)
+);
+
+-- Every existing account gets the base role
+INSERT INTO user_roles (user_id, role) SELECT id, 'user' FROM users ON CONFLICT DO NOTHING;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS authz_audit_log (
+    id bigserial PRIMARY KEY,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    request_id varchar(255) NOT NULL,
+    user_id bigint NOT NULL,
+    roles varchar(50) [] NOT NULL DEFAULT '{}',
+    action varchar(100) NOT NULL,
+    resource_type varchar(50) NOT NULL,
+    resource_owner_id bigint NOT NULL,
+    allowed boolean NOT NULL,
+    rule varchar(255) NOT NULL,
+    reason text NOT NULL
+);
+
+create index if not exists idx_authz_audit_log_user_id on authz_audit_log (user_id);
+create index if not exists idx_authz_audit_log_created_at on authz_audit_log (created_at);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider varchar(50) NOT NULL,
+    subject varchar(255) NOT NULL,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email citext,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (provider, subject)
+);
+
+create index if not exists idx_user_identities_user_id on user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state bytea PRIMARY KEY,
+    provider varchar(50) NOT NULL,
+    code_verifier text NOT NULL,
+    nonce text NOT NULL,
+    expires_at timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS login_failures (
+    key varchar(320) PRIMARY KEY,
+    failures integer NOT NULL DEFAULT 0,
+    last_failed_at timestamp with time zone NOT NULL DEFAULT now(),
+    locked_until timestamp with time zone
+);
+
+CREATE TABLE IF NOT EXISTS security_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    type varchar(50) NOT NULL,
+    user_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    ip varchar(64) NOT NULL,
+    request_id varchar(255) NOT NULL,
+    details text NOT NULL
+);
+
+create index if not exists idx_security_events_user_id on security_events (user_id);
+create index if not exists idx_security_events_created_at on security_events (created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_post_id_id;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS updated_at;
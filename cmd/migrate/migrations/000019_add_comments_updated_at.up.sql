@@ -0,0 +1,6 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT now();
+
+UPDATE comments SET updated_at = created_at WHERE created_at IS NOT NULL;
+
+-- Cursor pagination walks the comments of a post by id
+create index if not exists idx_comments_post_id_id on comments (post_id, id);
@@ -0,0 +1,5 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS parent_id integer REFERENCES comments(id) ON DELETE CASCADE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS depth integer NOT NULL DEFAULT 0;
+
+-- Replies of a comment are paged by id
+create index if not exists idx_comments_parent_id_id on comments (parent_id, id);
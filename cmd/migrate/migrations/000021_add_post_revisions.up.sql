@@ -0,0 +1,11 @@
+-- One row per edit, holding the post as it was before the edit
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id bigserial PRIMARY KEY,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    editor_id bigint REFERENCES users(id) ON DELETE SET NULL,
+    edited_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    UNIQUE (post_id, version)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+-- Trash listings and the purge job only look at deleted posts
+create index if not exists idx_posts_deleted_at on posts (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
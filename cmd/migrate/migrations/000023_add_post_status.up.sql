@@ -0,0 +1,10 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'scheduled', 'published'));
+
+-- publish_at is when a post went or goes live; drafts have none
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+
+UPDATE posts SET publish_at = created_at WHERE publish_at IS NULL;
+
+-- The scheduler picks up due posts in publish order
+create index if not exists idx_posts_scheduled_publish_at on posts (publish_at) WHERE status = 'scheduled';
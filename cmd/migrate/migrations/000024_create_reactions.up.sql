@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS reactions (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_type varchar(16) NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id bigint NOT NULL,
+    kind varchar(32) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, target_type, target_id, kind)
+);
+
+-- Counts are aggregated per target
+create index if not exists idx_reactions_target on reactions (target_type, target_id, kind);
+
+-- Targets are polymorphic, so reactions are removed with their post or
+-- comment by trigger rather than by foreign key. Triggers also catch comments
+-- removed by cascade.
+CREATE OR REPLACE FUNCTION delete_target_reactions() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM reactions WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS posts_delete_reactions ON posts;
+CREATE TRIGGER posts_delete_reactions AFTER DELETE ON posts
+    FOR EACH ROW EXECUTE FUNCTION delete_target_reactions('post');
+
+DROP TRIGGER IF EXISTS comments_delete_reactions ON comments;
+CREATE TRIGGER comments_delete_reactions AFTER DELETE ON comments
+    FOR EACH ROW EXECUTE FUNCTION delete_target_reactions('comment');
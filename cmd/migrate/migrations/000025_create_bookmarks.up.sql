@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name varchar(100) NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT bookmark_collections_user_id_name_key UNIQUE (user_id, name)
+);
+
+-- A post is bookmarked at most once per user, in at most one collection.
+-- Deleting a collection keeps its bookmarks outside of any collection.
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    collection_id bigint REFERENCES bookmark_collections(id) ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    UNIQUE (user_id, post_id)
+);
+
+-- Bookmarks are listed newest first, per user and per collection
+create index if not exists idx_bookmarks_user_id_id on bookmarks (user_id, id);
+create index if not exists idx_bookmarks_collection_id_id on bookmarks (collection_id, id);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS reposts (
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, post_id)
+);
+
+create index if not exists idx_reposts_post_id on reposts (post_id);
+
+-- No foreign key: a quote outlives the post it quotes and shows a tombstone
+-- in its place
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS quoted_post_id bigint;
+
+create index if not exists idx_posts_quoted_post_id on posts (quoted_post_id) WHERE quoted_post_id IS NOT NULL;
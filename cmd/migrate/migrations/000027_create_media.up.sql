@@ -0,0 +1,19 @@
+-- Uploaded files. The bytes live in the blob store under key; a media row is
+-- unattached until a post is created with it. Unattached media, including
+-- media of purged posts, is removed by a background job.
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key text NOT NULL UNIQUE,
+    thumbnail_key text,
+    content_type varchar(100) NOT NULL,
+    size_bytes bigint NOT NULL,
+    width int,
+    height int,
+    post_id bigint REFERENCES posts(id) ON DELETE SET NULL,
+    position int NOT NULL DEFAULT 0,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now()
+);
+
+create index if not exists idx_media_post_id on media (post_id, position);
+create index if not exists idx_media_unattached on media (created_at) WHERE post_id IS NULL;
@@ -0,0 +1,37 @@
+-- A user blocking another keeps the blocked user from mentioning them.
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+
+-- @mentions in the content of a post or of a comment. Offsets count runes
+-- and cover the @.
+CREATE TABLE IF NOT EXISTS mentions (
+    id bigserial PRIMARY KEY,
+    post_id bigint REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments(id) ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    start_offset int NOT NULL,
+    end_offset int NOT NULL,
+    CHECK ((post_id IS NULL) <> (comment_id IS NULL))
+);
+
+create index if not exists idx_mentions_post_id on mentions (post_id) WHERE post_id IS NOT NULL;
+create index if not exists idx_mentions_comment_id on mentions (comment_id) WHERE comment_id IS NOT NULL;
+
+-- comment_id is set when the notification is about a comment on post_id.
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind varchar(20) NOT NULL,
+    post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments(id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    read_at timestamp(0) with time zone
+);
+
+create index if not exists idx_notifications_user_id_id on notifications (user_id, id);
@@ -0,0 +1,3 @@
+-- Who moved a post to the trash, so that only they or a moderator can take
+-- it out again. NULL for posts deleted before this was recorded.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_by bigint REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- The feed reads each followed user's latest posts and reposts
+create index if not exists idx_posts_user_id_publish_at on posts (user_id, publish_at) WHERE status = 'published' AND deleted_at IS NULL;
+create index if not exists idx_reposts_user_id_created_at on reposts (user_id, created_at);
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Entry records a single authorization decision.
+type Entry struct {
+	Time            time.Time `json:"time"`
+	RequestID       string    `json:"request_id"`
+	UserID          int64     `json:"user_id"`
+	Roles           []string  `json:"roles"`
+	Action          string    `json:"action"`
+	ResourceType    string    `json:"resource_type"`
+	ResourceOwnerID int64     `json:"resource_owner_id"`
+	Allowed         bool      `json:"allowed"`
+	Rule            string    `json:"rule"`
+	Reason          string    `json:"reason"`
+}
+
+// Sink stores authorization decisions.
+type Sink interface {
+	Record(ctx context.Context, e Entry) error
+}
+
+// ZapSink writes decisions to a structured logger.
+type ZapSink struct {
+	logger *zap.SugaredLogger
+}
+
+func NewZapSink(logger *zap.SugaredLogger) *ZapSink {
+	return &ZapSink{logger: logger.Named("audit")}
+}
+
+func (s *ZapSink) Record(_ context.Context, e Entry) error {
+	s.logger.Infow("authorization decision",
+		"time", e.Time,
+		"request_id", e.RequestID,
+		"user_id", e.UserID,
+		"roles", e.Roles,
+		"action", e.Action,
+		"resource_type", e.ResourceType,
+		"resource_owner_id", e.ResourceOwnerID,
+		"allowed", e.Allowed,
+		"rule", e.Rule,
+		"reason", e.Reason,
+	)
+	return nil
+}
+
+// MultiSink fans every entry out to several sinks.
+type MultiSink []Sink
+
+func (m MultiSink) Record(ctx context.Context, e Entry) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Record(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
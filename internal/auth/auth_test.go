@@ -1,10 +1,15 @@
 package auth
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"strings"
 	"testing"
 	"time"
 
+	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -296,3 +301,500 @@ func TestPolicyEngine_ResourceAttributes(t *testing.T) {
 	}
 	assert.True(t, engine.Authorize(user, "read", ownResource))
 }
+
+func TestNewOpaqueToken(t *testing.T) {
+	token, hash, err := NewOpaqueToken()
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	// The stored hash must be reproducible from the token handed to the client
+	assert.Equal(t, hash, HashOpaqueToken(token))
+
+	// Tokens must not repeat
+	other, _, err := NewOpaqueToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestJWTManager_GenerateToken_SetsUniqueID(t *testing.T) {
+	manager := NewManager("test-secret", "test-issuer", "test-audience")
+
+	token1, err := manager.GenerateToken(123, "testuser", time.Hour)
+	require.NoError(t, err)
+	token2, err := manager.GenerateToken(123, "testuser", time.Hour)
+	require.NoError(t, err)
+
+	claims1, err := manager.ParseAndValidate(token1)
+	require.NoError(t, err)
+	claims2, err := manager.ParseAndValidate(token2)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, claims1.ID)
+	assert.NotEqual(t, claims1.ID, claims2.ID)
+}
+
+func TestMemoryRevocationList(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	list := NewMemoryRevocationList()
+	list.Now = func() time.Time { return now }
+
+	require.NoError(t, list.Revoke(ctx, "short", now.Add(time.Minute)))
+	require.NoError(t, list.Revoke(ctx, "long", now.Add(time.Hour)))
+
+	revoked, err := list.IsRevoked(ctx, "short")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = list.IsRevoked(ctx, "unknown")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Once the token would have expired anyway the entry can be dropped
+	now = now.Add(30 * time.Minute)
+	require.NoError(t, list.PurgeExpired(ctx))
+	assert.Equal(t, 1, list.Len())
+
+	revoked, err = list.IsRevoked(ctx, "long")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func newTestKeyring(t *testing.T) *Keyring {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaEntry, err := NewKey("rsa-1", rsaKey)
+	require.NoError(t, err)
+	edEntry, err := NewKey("ed-1", edKey)
+	require.NoError(t, err)
+
+	return NewKeyring().Add(rsaEntry).Add(edEntry)
+}
+
+func TestJWTManager_Keyring_SignAndVerify(t *testing.T) {
+	for _, kid := range []string{"rsa-1", "ed-1"} {
+		t.Run(kid, func(t *testing.T) {
+			keys := newTestKeyring(t)
+			require.NoError(t, keys.SetActive(kid))
+			manager := NewManagerWithKeyring(keys, "test-issuer", "test-audience")
+
+			token, err := manager.GenerateToken(123, "testuser", time.Hour)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, kid, parsed.Header["kid"])
+
+			claims, err := manager.ParseAndValidate(token)
+			require.NoError(t, err)
+			assert.Equal(t, int64(123), claims.UserID)
+		})
+	}
+}
+
+func TestJWTManager_Keyring_Rotation(t *testing.T) {
+	keys := newTestKeyring(t)
+	require.NoError(t, keys.SetActive("rsa-1"))
+	manager := NewManagerWithKeyring(keys, "test-issuer", "test-audience")
+
+	oldToken, err := manager.GenerateToken(123, "testuser", time.Hour)
+	require.NoError(t, err)
+
+	// Rotate to the new key; tokens signed with the old one stay valid
+	require.NoError(t, keys.SetActive("ed-1"))
+	_, err = manager.ParseAndValidate(oldToken)
+	require.NoError(t, err)
+
+	// Once the old key is removed they are rejected
+	keys.Remove("rsa-1")
+	_, err = manager.ParseAndValidate(oldToken)
+	assert.Error(t, err)
+}
+
+func TestJWTManager_Keyring_RejectsHMACToken(t *testing.T) {
+	keys := newTestKeyring(t)
+	require.NoError(t, keys.SetActive("rsa-1"))
+	manager := NewManagerWithKeyring(keys, "test-issuer", "test-audience")
+
+	hmacToken, err := NewManager("test-secret", "test-issuer", "test-audience").GenerateToken(123, "testuser", time.Hour)
+	require.NoError(t, err)
+
+	_, err = manager.ParseAndValidate(hmacToken)
+	assert.Error(t, err)
+}
+
+func TestKeyring_JWKS(t *testing.T) {
+	keys := newTestKeyring(t)
+
+	set := keys.JWKS()
+	require.Len(t, set.Keys, 2)
+
+	assert.Equal(t, "ed-1", set.Keys[0].Kid)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+	assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+	assert.NotEmpty(t, set.Keys[0].X)
+
+	assert.Equal(t, "rsa-1", set.Keys[1].Kid)
+	assert.Equal(t, "RSA", set.Keys[1].Kty)
+	assert.Equal(t, "RS256", set.Keys[1].Alg)
+	assert.Equal(t, "AQAB", set.Keys[1].E)
+}
+
+func TestKeyring_SetActive_RequiresPrivateKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key, err := NewKey("verify-only", pub)
+	require.NoError(t, err)
+
+	keys := NewKeyring().Add(key)
+	assert.Error(t, keys.SetActive("verify-only"))
+	assert.ErrorIs(t, keys.SetActive("missing"), ErrUnknownKeyID)
+}
+
+func TestJWTManager_GenerateToken_WithRoles(t *testing.T) {
+	manager := NewManager("test-secret", "test-issuer", "test-audience")
+
+	token, err := manager.GenerateToken(123, "testuser", time.Hour, WithRoles(RoleUser, RoleModerator))
+	require.NoError(t, err)
+
+	claims, err := manager.ParseAndValidate(token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RoleUser, RoleModerator}, claims.Roles)
+}
+
+func TestPolicyEngine_DefaultRules_Roles(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+
+	user := Subject{UserID: 1, Roles: []string{RoleUser}}
+	moderator := Subject{UserID: 2, Roles: []string{RoleUser, RoleModerator}}
+	admin := Subject{UserID: 3, Roles: []string{RoleUser, RoleAdmin}}
+	otherPost := Resource{Type: "post", OwnerID: 4}
+	otherUser := Resource{Type: "user", OwnerID: 4}
+
+	// Moderators can delete, but not edit, other users' posts
+	assert.True(t, engine.Authorize(moderator, ActionPostDelete, otherPost))
+	assert.False(t, engine.Authorize(moderator, ActionPostUpdate, otherPost))
+
+	// Admins can do everything
+	assert.True(t, engine.Authorize(admin, ActionPostDelete, otherPost))
+	assert.True(t, engine.Authorize(admin, ActionPostUpdate, otherPost))
+	assert.True(t, engine.Authorize(admin, ActionRoleAssign, otherUser))
+
+	// Only admins can manage roles
+	assert.False(t, engine.Authorize(user, ActionRoleAssign, otherUser))
+	assert.False(t, engine.Authorize(moderator, ActionRoleAssign, otherUser))
+	assert.False(t, engine.Authorize(moderator, ActionRoleRevoke, otherUser))
+
+	// Roles do not help unauthenticated subjects
+	assert.False(t, engine.Authorize(Subject{Roles: []string{RoleAdmin}}, ActionPostDelete, otherPost))
+}
+
+func TestPolicyEngine_Decide(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+
+	user := Subject{UserID: 1}
+
+	decision := engine.Decide(user, ActionPostUpdate, Resource{Type: "post", OwnerID: 1})
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "owners-modify-posts", decision.Rule)
+
+	decision = engine.Decide(user, ActionPostUpdate, Resource{Type: "post", OwnerID: 2})
+	assert.False(t, decision.Allowed)
+	assert.Empty(t, decision.Rule)
+	assert.Contains(t, decision.Reason, ActionPostUpdate)
+}
+
+func TestPolicyEngine_Decide_DenyRule(t *testing.T) {
+	engine := NewPolicyEngine().
+		AllowNamed("everyone", func(Subject, string, Resource) bool { return true }).
+		DenyNamed("no-user-2", func(s Subject, _ string, _ Resource) bool { return s.UserID == 2 })
+
+	decision := engine.Decide(Subject{UserID: 2}, "any", Resource{})
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, "no-user-2", decision.Rule)
+
+	decision = engine.Decide(Subject{UserID: 1}, "any", Resource{})
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, "everyone", decision.Rule)
+}
+
+func TestRequiredScope(t *testing.T) {
+	actions := []string{ActionPostCreate, ActionPostUpdate, ActionPostDelete, ActionPostRepost, ActionCommentCreate, ActionCommentUpdate, ActionCommentDelete, ActionPostReact, ActionCommentReact, ActionUserFollow, ActionUserUnfollow, ActionRoleRead, ActionRoleAssign, ActionRoleRevoke}
+
+	// Every action must be reachable with some scope
+	for _, action := range actions {
+		scope, ok := RequiredScope(action)
+		assert.True(t, ok, action)
+		assert.Contains(t, Scopes, scope, action)
+	}
+
+	_, ok := RequiredScope("unknown:action")
+	assert.False(t, ok)
+}
+
+func TestRequiredScope_Comments(t *testing.T) {
+	for _, action := range []string{ActionCommentCreate, ActionCommentUpdate, ActionCommentDelete} {
+		scope, ok := RequiredScope(action)
+		assert.True(t, ok, action)
+		assert.Equal(t, ScopeCommentsWrite, scope, action)
+	}
+}
+
+func TestNewPersonalAccessToken(t *testing.T) {
+	token, hash, err := NewPersonalAccessToken()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(token, PersonalAccessTokenPrefix))
+	assert.Equal(t, hash, HashOpaqueToken(token))
+}
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// Base32 of the RFC 6238 SHA1 test key "12345678901234567890"
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(tc.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tc.code, code, "unix time %d", tc.unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	require.NoError(t, err)
+
+	now := time.Unix(1_700_000_000, 0)
+	code, err := TOTPCode(secret, TOTPStep(now))
+	require.NoError(t, err)
+
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, TOTPStep(now), step)
+
+	// One period of clock drift is tolerated, two are not
+	_, ok = ValidateTOTP(secret, code, now.Add(30*time.Second))
+	assert.True(t, ok)
+	_, ok = ValidateTOTP(secret, code, now.Add(90*time.Second))
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("social-go", "alice@example.com", "ABCDEF")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/social-go:alice@example.com?"))
+	assert.Contains(t, uri, "secret=ABCDEF")
+	assert.Contains(t, uri, "issuer=social-go")
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes(10)
+	require.NoError(t, err)
+	require.Len(t, codes, 10)
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		assert.Len(t, code, 11)
+		assert.Equal(t, code, NormalizeRecoveryCode(strings.ToUpper(strings.ReplaceAll(code, "-", ""))))
+		assert.False(t, seen[code])
+		seen[code] = true
+	}
+}
+
+func TestSecretBox(t *testing.T) {
+	box, err := NewSecretBox("passphrase")
+	require.NoError(t, err)
+
+	sealed, err := box.Seal([]byte("JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "JBSWY3DPEHPK3PXP")
+
+	opened, err := box.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", string(opened))
+
+	other, err := NewSecretBox("other")
+	require.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.Error(t, err)
+}
+
+func TestJWTManager_GenerateToken_WithPurpose(t *testing.T) {
+	manager := NewManager("test-secret", "test-issuer", "test-audience")
+
+	token, err := manager.GenerateToken(1, "alice", time.Minute, WithPurpose(PurposeMFAPending))
+	require.NoError(t, err)
+
+	claims, err := manager.ParseAndValidatePurpose(token, PurposeMFAPending)
+	require.NoError(t, err)
+	assert.Equal(t, PurposeMFAPending, claims.Purpose)
+	assert.False(t, claims.IsAccessToken())
+	assert.Equal(t, []string{"test-audience:mfa_pending"}, []string(claims.Audience))
+
+	// The token has an audience of its own, so it isn't accepted as an access token
+	_, err = manager.ParseAndValidate(token)
+	assert.Error(t, err)
+}
+
+func TestJWTManager_ParseAndValidatePurpose_RejectsAccessToken(t *testing.T) {
+	manager := NewManager("test-secret", "test-issuer", "test-audience")
+
+	token, err := manager.GenerateToken(1, "alice", time.Minute)
+	require.NoError(t, err)
+
+	_, err = manager.ParseAndValidatePurpose(token, PurposeMFAPending)
+	assert.Error(t, err)
+}
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	p := LockoutPolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		Threshold:       10,
+		LockoutDuration: 15 * time.Minute,
+	}
+
+	testCases := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{9, 30 * time.Second},
+		{10, 15 * time.Minute},
+		{25, 15 * time.Minute},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.delay, p.Delay(tc.failures), "failures %d", tc.failures)
+	}
+
+	assert.False(t, p.Locked(9))
+	assert.True(t, p.Locked(10))
+	assert.False(t, LockoutPolicy{}.Locked(100))
+}
+
+func TestJWTManager_GenerateToken_WithSession(t *testing.T) {
+	manager := NewManager("test-secret", "test-issuer", "test-audience")
+
+	token, err := manager.GenerateToken(1, "alice", time.Minute, WithSession("session-1"))
+	require.NoError(t, err)
+
+	claims, err := manager.ParseAndValidate(token)
+	require.NoError(t, err)
+	assert.Equal(t, "session-1", claims.SessionID)
+	assert.True(t, claims.IsAccessToken())
+}
+
+func TestPolicyEngine_DefaultRules_CommentActions(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+
+	author := Subject{UserID: 1}
+	postOwner := Subject{UserID: 2}
+	other := Subject{UserID: 3}
+	moderator := Subject{UserID: 4, Roles: []string{RoleModerator}}
+	comment := Resource{Type: "comment", OwnerID: 1, Attr: map[string]any{"post_owner_id": int64(2)}}
+
+	assert.True(t, engine.Authorize(other, ActionCommentCreate, Resource{Type: "comment"}))
+	assert.False(t, engine.Authorize(Subject{}, ActionCommentCreate, Resource{Type: "comment"}))
+
+	assert.True(t, engine.Authorize(author, ActionCommentUpdate, comment))
+	assert.True(t, engine.Authorize(author, ActionCommentDelete, comment))
+
+	// Post owners moderate their threads but can't put words in others' mouths
+	assert.True(t, engine.Authorize(postOwner, ActionCommentDelete, comment))
+	assert.False(t, engine.Authorize(postOwner, ActionCommentUpdate, comment))
+
+	assert.False(t, engine.Authorize(other, ActionCommentUpdate, comment))
+	assert.False(t, engine.Authorize(other, ActionCommentDelete, comment))
+
+	assert.True(t, engine.Authorize(moderator, ActionCommentDelete, comment))
+	assert.False(t, engine.Authorize(moderator, ActionCommentUpdate, comment))
+}
+
+func TestPolicyEngine_DefaultRules_Reactions(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+
+	user := Subject{UserID: 3}
+	post := Resource{Type: "post", OwnerID: 1}
+	comment := Resource{Type: "comment", OwnerID: 1, Attr: map[string]any{"post_owner_id": int64(2)}}
+
+	assert.True(t, engine.Authorize(user, ActionPostReact, post))
+	assert.True(t, engine.Authorize(user, ActionCommentReact, comment))
+	assert.True(t, engine.Authorize(Subject{UserID: 1}, ActionPostReact, post), "authors may react to their own posts")
+
+	assert.False(t, engine.Authorize(Subject{}, ActionPostReact, post))
+	assert.False(t, engine.Authorize(user, ActionCommentReact, post))
+	assert.False(t, engine.Authorize(user, ActionPostReact, comment))
+}
+
+func TestPolicyEngine_DefaultRules_Repost(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+	post := Resource{Type: "post", OwnerID: 1}
+
+	assert.True(t, engine.Authorize(Subject{UserID: 2}, ActionPostRepost, post))
+	assert.True(t, engine.Authorize(Subject{UserID: 1}, ActionPostRepost, post))
+	assert.False(t, engine.Authorize(Subject{}, ActionPostRepost, post))
+	assert.False(t, engine.Authorize(Subject{UserID: 2}, ActionPostRepost, Resource{Type: "comment", OwnerID: 1}))
+}
+
+func TestPolicyEngine_DefaultRules_BookmarksArePrivate(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+
+	owner := Subject{UserID: 1}
+	admin := Subject{UserID: 2, Roles: []string{RoleAdmin}}
+	bookmark := Resource{Type: "bookmark", OwnerID: 1}
+	collection := Resource{Type: "bookmark_collection", OwnerID: 1}
+
+	for _, action := range []string{ActionBookmarkRead, ActionBookmarkWrite} {
+		assert.True(t, engine.Authorize(owner, action, bookmark), action)
+		assert.True(t, engine.Authorize(owner, action, collection), action)
+
+		assert.False(t, engine.Authorize(Subject{UserID: 3}, action, bookmark), action)
+		assert.False(t, engine.Authorize(Subject{}, action, Resource{Type: "bookmark"}), action)
+
+		decision := engine.Decide(admin, action, collection)
+		assert.False(t, decision.Allowed, action)
+		assert.Equal(t, "bookmarks-private", decision.Rule)
+	}
+}
+
+func TestPolicyEngine_DefaultRules_Restore(t *testing.T) {
+	engine := NewDefaultPolicyEngine()
+
+	owner := Subject{UserID: 1}
+	moderator := Subject{UserID: 2, Roles: []string{RoleModerator}}
+	deletedByOwner := Resource{Type: "post", OwnerID: 1, Attr: map[string]any{"deleted_by": int64(1)}}
+	deletedByModerator := Resource{Type: "post", OwnerID: 1, Attr: map[string]any{"deleted_by": int64(2)}}
+
+	assert.True(t, engine.Authorize(owner, ActionPostRestore, deletedByOwner))
+	assert.False(t, engine.Authorize(owner, ActionPostRestore, deletedByModerator))
+	assert.False(t, engine.Authorize(owner, ActionPostRestore, Resource{Type: "post", OwnerID: 1}))
+	assert.False(t, engine.Authorize(Subject{UserID: 3}, ActionPostRestore, deletedByOwner))
+
+	assert.True(t, engine.Authorize(moderator, ActionPostRestore, deletedByModerator))
+	assert.True(t, engine.Authorize(moderator, ActionPostRestore, deletedByOwner))
+}
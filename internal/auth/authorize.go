@@ -1,12 +1,25 @@
 package auth
 
+import "fmt"
+
 // A simple policy engine with allow rules and deny-by-default semantics.
+// Deny rules, when present, override any matching allow rule.
 
 type Subject struct {
 	UserID int64
 	Roles  []string
 }
 
+// HasRole reports whether the subject was granted the given role.
+func (s Subject) HasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 type Resource struct {
 	Type    string
 	OwnerID int64
@@ -15,52 +28,165 @@ type Resource struct {
 
 type Rule func(Subject, string, Resource) bool
 
+// Decision is the outcome of a policy evaluation together with the rule that
+// produced it.
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// Authorizer decides whether a subject may perform an action on a resource.
+type Authorizer interface {
+	Authorize(sub Subject, action string, res Resource) bool
+	Decide(sub Subject, action string, res Resource) Decision
+}
+
+type namedRule struct {
+	name string
+	fn   Rule
+}
+
 type PolicyEngine struct {
-	rules []Rule
+	rules []namedRule
+	deny  []namedRule
 }
 
 func NewPolicyEngine() *PolicyEngine {
-	return &PolicyEngine{rules: make([]Rule, 0, 8)}
+	return &PolicyEngine{rules: make([]namedRule, 0, 8)}
 }
 
+// Allow adds an unnamed allow rule. Prefer AllowNamed so decisions can be explained.
 func (e *PolicyEngine) Allow(r Rule) *PolicyEngine {
-	e.rules = append(e.rules, r)
+	return e.AllowNamed(fmt.Sprintf("allow#%d", len(e.rules)+1), r)
+}
+
+func (e *PolicyEngine) AllowNamed(name string, r Rule) *PolicyEngine {
+	e.rules = append(e.rules, namedRule{name: name, fn: r})
 	return e
 }
 
-// Authorize evaluates rules and returns true if any rule allows the action.
+// Deny adds a rule that rejects the action whenever it matches, regardless of allow rules.
+func (e *PolicyEngine) Deny(r Rule) *PolicyEngine {
+	return e.DenyNamed(fmt.Sprintf("deny#%d", len(e.deny)+1), r)
+}
+
+func (e *PolicyEngine) DenyNamed(name string, r Rule) *PolicyEngine {
+	e.deny = append(e.deny, namedRule{name: name, fn: r})
+	return e
+}
+
+// Authorize evaluates rules and returns true if any rule allows the action
+// and no deny rule matches.
 func (e *PolicyEngine) Authorize(sub Subject, action string, res Resource) bool {
+	return e.Decide(sub, action, res).Allowed
+}
+
+// Decide evaluates rules like Authorize and reports which rule decided the outcome.
+func (e *PolicyEngine) Decide(sub Subject, action string, res Resource) Decision {
+	for _, rule := range e.deny {
+		if rule.fn(sub, action, res) {
+			return Decision{
+				Allowed: false,
+				Rule:    rule.name,
+				Reason:  fmt.Sprintf("denied by rule %q", rule.name),
+			}
+		}
+	}
 	for _, rule := range e.rules {
-		if rule(sub, action, res) {
-			return true
+		if rule.fn(sub, action, res) {
+			return Decision{
+				Allowed: true,
+				Rule:    rule.name,
+				Reason:  fmt.Sprintf("allowed by rule %q", rule.name),
+			}
 		}
 	}
-	return false
+	return Decision{
+		Allowed: false,
+		Reason:  fmt.Sprintf("no rule allows %q on resource type %q (checked %d rules)", action, res.Type, len(e.rules)),
+	}
 }
 
 // Common action constants
 const (
-	ActionPostCreate   = "post:create"
-	ActionPostUpdate   = "post:update"
-	ActionPostDelete   = "post:delete"
-	ActionUserFollow   = "user:follow"
-	ActionUserUnfollow = "user:unfollow"
+	ActionPostCreate = "post:create"
+	ActionPostUpdate = "post:update"
+	ActionPostDelete = "post:delete"
+	ActionPostRepost = "post:repost"
+	// Restoring from the trash carries who deleted the post in Attr["deleted_by"]
+	ActionPostRestore = "post:restore"
+	// Comment resources carry the post owner in Attr["post_owner_id"]
+	ActionCommentCreate = "comment:create"
+	ActionCommentUpdate = "comment:update"
+	ActionCommentDelete = "comment:delete"
+	ActionPostReact     = "post:react"
+	ActionCommentReact  = "comment:react"
+	// Bookmark actions apply to "bookmark" and "bookmark_collection" resources
+	ActionBookmarkRead  = "bookmark:read"
+	ActionBookmarkWrite = "bookmark:write"
+	ActionUserFollow    = "user:follow"
+	ActionUserUnfollow  = "user:unfollow"
+	ActionRoleRead      = "role:read"
+	ActionRoleAssign    = "role:assign"
+	ActionRoleRevoke    = "role:revoke"
 )
 
+// Role constants
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role that can be assigned to a user.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
 // NewDefaultPolicyEngine returns an engine with common default rules.
 func NewDefaultPolicyEngine() *PolicyEngine {
 	e := NewPolicyEngine()
 
+	// Bookmarks are private, even to admins
+	e.DenyNamed("bookmarks-private", func(s Subject, action string, r Resource) bool {
+		return (action == ActionBookmarkRead || action == ActionBookmarkWrite) && s.UserID != r.OwnerID
+	})
+
+	// Admins can do everything
+	e.AllowNamed("admins-all", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && s.HasRole(RoleAdmin)
+	})
+
+	// Moderators can delete any post
+	e.AllowNamed("moderators-delete-posts", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && s.HasRole(RoleModerator) && r.Type == "post" && action == ActionPostDelete
+	})
+
+	// Moderators can restore any post from the trash, including their own
+	// mistaken deletions
+	e.AllowNamed("moderators-restore-posts", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && s.HasRole(RoleModerator) && r.Type == "post" && action == ActionPostRestore
+	})
+
+	// Moderators can delete any comment
+	e.AllowNamed("moderators-delete-comments", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && s.HasRole(RoleModerator) && r.Type == "comment" && action == ActionCommentDelete
+	})
+
 	// Anyone authenticated can create posts
-	e.Allow(func(s Subject, action string, r Resource) bool {
+	e.AllowNamed("users-create-posts", func(s Subject, action string, r Resource) bool {
 		if action == ActionPostCreate && r.Type == "post" {
 			return s.UserID != 0
 		}
 		return false
 	})
 
+	// Anyone authenticated can repost
+	e.AllowNamed("users-repost-posts", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && r.Type == "post" && action == ActionPostRepost
+	})
+
 	// Only owners can update/delete their posts
-	e.Allow(func(s Subject, action string, r Resource) bool {
+	e.AllowNamed("owners-modify-posts", func(s Subject, action string, r Resource) bool {
 		if r.Type != "post" {
 			return false
 		}
@@ -70,8 +196,62 @@ func NewDefaultPolicyEngine() *PolicyEngine {
 		return false
 	})
 
+	// Owners can restore their posts, but only from their own deletions; a
+	// moderator's deletion stands
+	e.AllowNamed("owners-restore-posts", func(s Subject, action string, r Resource) bool {
+		if r.Type != "post" || action != ActionPostRestore {
+			return false
+		}
+		deletedBy, _ := r.Attr["deleted_by"].(int64)
+		return s.UserID != 0 && s.UserID == r.OwnerID && s.UserID == deletedBy
+	})
+
+	// Anyone authenticated can comment
+	e.AllowNamed("users-create-comments", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && r.Type == "comment" && action == ActionCommentCreate
+	})
+
+	// Authors can update/delete their comments
+	e.AllowNamed("authors-modify-comments", func(s Subject, action string, r Resource) bool {
+		if r.Type != "comment" {
+			return false
+		}
+		if action == ActionCommentUpdate || action == ActionCommentDelete {
+			return s.UserID != 0 && s.UserID == r.OwnerID
+		}
+		return false
+	})
+
+	// Post owners can delete comments on their posts
+	e.AllowNamed("post-owners-delete-comments", func(s Subject, action string, r Resource) bool {
+		if r.Type != "comment" || action != ActionCommentDelete {
+			return false
+		}
+		postOwnerID, _ := r.Attr["post_owner_id"].(int64)
+		return s.UserID != 0 && s.UserID == postOwnerID
+	})
+
+	// Anyone authenticated can react to posts and comments
+	e.AllowNamed("users-react-to-posts", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && r.Type == "post" && action == ActionPostReact
+	})
+	e.AllowNamed("users-react-to-comments", func(s Subject, action string, r Resource) bool {
+		return s.UserID != 0 && r.Type == "comment" && action == ActionCommentReact
+	})
+
+	// Users manage their own bookmarks and collections
+	e.AllowNamed("owners-manage-bookmarks", func(s Subject, action string, r Resource) bool {
+		if r.Type != "bookmark" && r.Type != "bookmark_collection" {
+			return false
+		}
+		if action == ActionBookmarkRead || action == ActionBookmarkWrite {
+			return s.UserID != 0 && s.UserID == r.OwnerID
+		}
+		return false
+	})
+
 	// A user can follow/unfollow others, but not themselves
-	e.Allow(func(s Subject, action string, r Resource) bool {
+	e.AllowNamed("users-follow-others", func(s Subject, action string, r Resource) bool {
 		if r.Type != "user" {
 			return false
 		}
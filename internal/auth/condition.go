@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Condition is a compiled rule condition such as `subject.UserID == resource.OwnerID`.
+//
+// A condition has the form `<operand> <operator> <operand>`. Operands are
+// either references (subject.UserID, subject.Roles, resource.Type,
+// resource.OwnerID, resource.Attr.<key>, action) or literals (quoted strings,
+// numbers, true, false, null). Supported operators are ==, !=, <, <=, >, >=
+// and in, which tests membership in a list.
+type Condition struct {
+	source string
+	left   operand
+	op     string
+	right  operand
+}
+
+type operand func(Subject, string, Resource) any
+
+var conditionOperators = map[string]bool{
+	"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "in": true,
+}
+
+// ParseCondition compiles a condition expression.
+func ParseCondition(expr string) (*Condition, error) {
+	tokens, err := splitCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) != 3 {
+		return nil, fmt.Errorf("condition %q: expected <operand> <operator> <operand>", expr)
+	}
+	if !conditionOperators[tokens[1]] {
+		return nil, fmt.Errorf("condition %q: unknown operator %q", expr, tokens[1])
+	}
+
+	left, err := parseOperand(tokens[0])
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", expr, err)
+	}
+	right, err := parseOperand(tokens[2])
+	if err != nil {
+		return nil, fmt.Errorf("condition %q: %w", expr, err)
+	}
+
+	return &Condition{source: expr, left: left, op: tokens[1], right: right}, nil
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+// Eval reports whether the condition holds for the request.
+func (c *Condition) Eval(sub Subject, action string, res Resource) bool {
+	l := normalize(c.left(sub, action, res))
+	r := normalize(c.right(sub, action, res))
+
+	switch c.op {
+	case "==":
+		return equal(l, r)
+	case "!=":
+		return !equal(l, r)
+	case "in":
+		return contains(r, l)
+	}
+
+	lf, lok := l.(float64)
+	rf, rok := r.(float64)
+	if !lok || !rok {
+		return false
+	}
+
+	switch c.op {
+	case "<":
+		return lf < rf
+	case "<=":
+		return lf <= rf
+	case ">":
+		return lf > rf
+	case ">=":
+		return lf >= rf
+	}
+	return false
+}
+
+func splitCondition(expr string) ([]string, error) {
+	var tokens []string
+	var cur strings.Builder
+	var quote rune
+
+	for _, ch := range strings.TrimSpace(expr) {
+		switch {
+		case quote != 0:
+			cur.WriteRune(ch)
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+			cur.WriteRune(ch)
+		case ch == ' ' || ch == '\t':
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(ch)
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("condition %q: unterminated string", expr)
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens, nil
+}
+
+func parseOperand(tok string) (operand, error) {
+	switch {
+	case len(tok) >= 2 && (tok[0] == '"' || tok[0] == '\'') && tok[len(tok)-1] == tok[0]:
+		v := tok[1 : len(tok)-1]
+		return constant(v), nil
+	case tok == "true":
+		return constant(true), nil
+	case tok == "false":
+		return constant(false), nil
+	case tok == "null":
+		return constant(nil), nil
+	case tok == "action":
+		return func(_ Subject, action string, _ Resource) any { return action }, nil
+	case tok == "subject.UserID":
+		return func(s Subject, _ string, _ Resource) any { return s.UserID }, nil
+	case tok == "subject.Roles":
+		return func(s Subject, _ string, _ Resource) any { return s.Roles }, nil
+	case tok == "resource.Type":
+		return func(_ Subject, _ string, r Resource) any { return r.Type }, nil
+	case tok == "resource.OwnerID":
+		return func(_ Subject, _ string, r Resource) any { return r.OwnerID }, nil
+	case strings.HasPrefix(tok, "resource.Attr."):
+		key := strings.TrimPrefix(tok, "resource.Attr.")
+		return func(_ Subject, _ string, r Resource) any { return r.Attr[key] }, nil
+	}
+
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return constant(f), nil
+	}
+	return nil, fmt.Errorf("unknown operand %q", tok)
+}
+
+func constant(v any) operand {
+	return func(Subject, string, Resource) any { return v }
+}
+
+// normalize converts numbers to float64 so that values from different sources compare equal.
+func normalize(v any) any {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	default:
+		return v
+	}
+}
+
+func equal(l, r any) bool {
+	switch l.(type) {
+	case nil, string, float64, bool:
+		return l == r
+	default:
+		return false
+	}
+}
+
+func contains(list, v any) bool {
+	switch items := list.(type) {
+	case []string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		for _, item := range items {
+			if item == s {
+				return true
+			}
+		}
+	case []any:
+		for _, item := range items {
+			if equal(v, normalize(item)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -9,14 +9,55 @@ import (
 
 // Claims represents our JWT claims including standard registered claims and custom fields.
 type Claims struct {
-	UserID   int64  `json:"user_id"`
-	Username string `json:"username"`
+	UserID   int64    `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	// Purpose restricts what a token can be used for; access tokens have none.
+	Purpose string `json:"purpose,omitempty"`
+	// SessionID is the login session the token was issued for.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// Manager handles JWT generation and validation.
+// PurposeMFAPending marks the short-lived token handed out after the password
+// step of a login that still needs a second factor.
+const PurposeMFAPending = "mfa_pending"
+
+// IsAccessToken reports whether the token may be used to call the API.
+func (c *Claims) IsAccessToken() bool {
+	return c.Purpose == ""
+}
+
+// TokenOption customizes the claims of a generated token.
+type TokenOption func(*Claims)
+
+// WithRoles embeds the user's roles in the token.
+func WithRoles(roles ...string) TokenOption {
+	return func(c *Claims) {
+		c.Roles = roles
+	}
+}
+
+// WithPurpose restricts the token to a single purpose, such as PurposeMFAPending.
+func WithPurpose(purpose string) TokenOption {
+	return func(c *Claims) {
+		c.Purpose = purpose
+	}
+}
+
+// WithSession ties the token to a login session so it stops working when the
+// session is terminated.
+func WithSession(sessionID string) TokenOption {
+	return func(c *Claims) {
+		c.SessionID = sessionID
+	}
+}
+
+// Manager handles JWT generation and validation. Tokens are signed with the
+// active key of Keys when it is set, and with the shared HMAC Secret otherwise.
 type Manager struct {
 	Secret   []byte
+	Keys     *Keyring
 	Issuer   string
 	Audience string
 	// Now provides current time; override in tests.
@@ -33,13 +74,29 @@ func NewManager(secret, issuer, audience string) *Manager {
 	}
 }
 
+// NewManagerWithKeyring creates a JWT manager that signs with asymmetric keys.
+func NewManagerWithKeyring(keys *Keyring, issuer, audience string) *Manager {
+	return &Manager{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: audience,
+		Now:      time.Now,
+	}
+}
+
 // GenerateToken signs and returns a JWT string for a given user and ttl.
-func (m *Manager) GenerateToken(userID int64, username string, ttl time.Duration) (string, error) {
+func (m *Manager) GenerateToken(userID int64, username string, ttl time.Duration, opts ...TokenOption) (string, error) {
+	jti, err := NewID()
+	if err != nil {
+		return "", err
+	}
+
 	now := m.Now()
 	claims := &Claims{
 		UserID:   userID,
 		Username: username,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			Issuer:    m.Issuer,
 			Subject:   username,
 			Audience:  jwt.ClaimStrings{m.Audience},
@@ -49,22 +106,74 @@ func (m *Manager) GenerateToken(userID int64, username string, ttl time.Duration
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.Secret)
+	for _, opt := range opts {
+		opt(claims)
+	}
+	claims.Audience = jwt.ClaimStrings{m.audienceFor(claims.Purpose)}
+
+	return m.sign(claims)
 }
 
-// ParseAndValidate parses the token string and validates signature and time-based claims.
-func (m *Manager) ParseAndValidate(tokenStr string) (*Claims, error) {
-	keyFunc := func(token *jwt.Token) (interface{}, error) {
+// audienceFor returns the audience of tokens with purpose. Tokens with a
+// purpose get an audience of their own, so that anything which only checks
+// the audience doesn't take them for access tokens.
+func (m *Manager) audienceFor(purpose string) string {
+	if purpose == "" {
+		return m.Audience
+	}
+	return m.Audience + ":" + purpose
+}
+
+func (m *Manager) sign(claims jwt.Claims) (string, error) {
+	if m.Keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(m.Secret)
+	}
+
+	key, err := m.Keys.Active()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+func (m *Manager) verificationKey(token *jwt.Token) (interface{}, error) {
+	if m.Keys == nil {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
 		return m.Secret, nil
 	}
 
-	parsedToken, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keyFunc,
+	return m.Keys.verificationKey(token)
+}
+
+// ParseAndValidate parses the token string and validates signature and time-based claims.
+// Tokens with a purpose are rejected; see ParseAndValidatePurpose.
+func (m *Manager) ParseAndValidate(tokenStr string) (*Claims, error) {
+	return m.parse(tokenStr, "")
+}
+
+// ParseAndValidatePurpose is ParseAndValidate for tokens generated with
+// WithPurpose(purpose).
+func (m *Manager) ParseAndValidatePurpose(tokenStr, purpose string) (*Claims, error) {
+	claims, err := m.parse(tokenStr, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token purpose")
+	}
+	return claims, nil
+}
+
+func (m *Manager) parse(tokenStr, purpose string) (*Claims, error) {
+	parsedToken, err := jwt.ParseWithClaims(tokenStr, &Claims{}, m.verificationKey,
 		jwt.WithIssuer(m.Issuer),
-		jwt.WithAudience(m.Audience),
+		jwt.WithAudience(m.audienceFor(purpose)),
 		jwt.WithLeeway(1*time.Minute), // small clock skew tolerance
 		jwt.WithTimeFunc(m.Now),       // Use custom time function for validation
 	)
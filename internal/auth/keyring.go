@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNoSigningKey   = errors.New("no active signing key")
+	ErrUnknownKeyID   = errors.New("unknown key id")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// Key is an asymmetric signing key identified by its kid. Keys without a
+// private part can only verify tokens, which is how retired keys are kept
+// around during a rotation window.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// NewKey wraps an RSA or Ed25519 private or public key.
+func NewKey(kid string, k any) (*Key, error) {
+	switch key := k.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, private: key, public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodRS256, public: key}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, private: key, public: key.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Method: jwt.SigningMethodEdDSA, public: key}, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, k)
+	}
+}
+
+// ParseKeyPEM parses a PKCS#8 / PKCS#1 private key or a PKIX public key.
+func ParseKeyPEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(kid, k)
+	case "RSA PRIVATE KEY":
+		k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(kid, k)
+	case "PUBLIC KEY":
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(kid, k)
+	default:
+		return nil, fmt.Errorf("%w: PEM type %q", ErrUnsupportedKey, block.Type)
+	}
+}
+
+// LoadKeyFile reads a PEM encoded key from disk.
+func LoadKeyFile(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyPEM(kid, data)
+}
+
+// CanSign reports whether the key holds a private part.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// Keyring holds the keys accepted for verification and the one used for signing.
+type Keyring struct {
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string]*Key)}
+}
+
+// Add registers a key for verification, replacing any key with the same kid.
+func (kr *Keyring) Add(key *Key) *Keyring {
+	kr.mu.Lock()
+	kr.keys[key.ID] = key
+	kr.mu.Unlock()
+	return kr
+}
+
+// SetActive selects the key new tokens are signed with.
+func (kr *Keyring) SetActive(kid string) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	key, ok := kr.keys[kid]
+	if !ok {
+		return ErrUnknownKeyID
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("key %q has no private key", kid)
+	}
+
+	kr.active = kid
+	return nil
+}
+
+// Remove drops a key once no valid tokens signed with it can remain.
+func (kr *Keyring) Remove(kid string) {
+	kr.mu.Lock()
+	delete(kr.keys, kid)
+	if kr.active == kid {
+		kr.active = ""
+	}
+	kr.mu.Unlock()
+}
+
+func (kr *Keyring) Active() (*Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	key, ok := kr.keys[kr.active]
+	if !ok {
+		return nil, ErrNoSigningKey
+	}
+	return key, nil
+}
+
+func (kr *Keyring) Get(kid string) (*Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	return key, nil
+}
+
+// verificationKey is a jwt.Keyfunc resolving the token's kid.
+func (kr *Keyring) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := kr.Get(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The algorithm is pinned by the key, never taken from the token alone
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// JWK is the public part of a key as published in a JWKS document (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring, sorted by kid.
+func (kr *Keyring) JWKS() JWKS {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(kr.keys))}
+	for _, key := range kr.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// PublicKey decodes an RSA or Ed25519 JWK.
+func (k JWK) PublicKey() (*Key, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid modulus: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: invalid exponent: %w", k.Kid, err)
+		}
+		return NewKey(k.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())})
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %q", ErrUnsupportedKey, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwk %q: invalid public key", k.Kid)
+		}
+		return NewKey(k.Kid, ed25519.PublicKey(x))
+	default:
+		return nil, fmt.Errorf("%w: kty %q", ErrUnsupportedKey, k.Kty)
+	}
+}
+
+// NewKeyringFromJWKS builds a verification-only keyring from a JWKS document.
+// Keys of unsupported types and keys not meant for signatures are skipped.
+func NewKeyringFromJWKS(set JWKS) *Keyring {
+	kr := NewKeyring()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		kr.Add(key)
+	}
+	return kr
+}
@@ -0,0 +1,42 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long login attempts are refused after a number of
+// consecutive failures. The first FreeAttempts failures cost nothing, then the
+// delay doubles from BaseDelay up to MaxDelay, and from Threshold failures on
+// attempts are refused for LockoutDuration.
+type LockoutPolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Threshold       int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered; a failure after a quiet
+	// Window starts counting from one again.
+	Window time.Duration
+}
+
+// Delay returns how long to refuse attempts after the given number of failures.
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if p.Locked(failures) {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts || p.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Locked reports whether failures reached the lockout threshold.
+func (p LockoutPolicy) Locked(failures int) bool {
+	return p.Threshold > 0 && failures >= p.Threshold
+}
@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+)
+
+// OIDCProviderConfig describes an OpenID Connect identity provider. Endpoints
+// are discovered from the issuer's /.well-known/openid-configuration.
+type OIDCProviderConfig struct {
+	Name         string   `yaml:"name" json:"name"`
+	Issuer       string   `yaml:"issuer" json:"issuer"`
+	ClientID     string   `yaml:"client_id" json:"client_id"`
+	ClientSecret string   `yaml:"client_secret" json:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url" json:"redirect_url"`
+	Scopes       []string `yaml:"scopes" json:"scopes"`
+}
+
+// OIDCDocument is the on-disk list of identity providers. YAML and JSON are
+// both accepted.
+type OIDCDocument struct {
+	Providers []OIDCProviderConfig `yaml:"providers" json:"providers"`
+}
+
+// ParseOIDCProviders parses a provider list. ${VAR} references are expanded
+// from the environment so client secrets can stay out of the file.
+func ParseOIDCProviders(data []byte) ([]OIDCProviderConfig, error) {
+	var doc OIDCDocument
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &doc); err != nil {
+		return nil, fmt.Errorf("parse oidc providers: %w", err)
+	}
+
+	seen := make(map[string]bool, len(doc.Providers))
+	for i, p := range doc.Providers {
+		if p.Name == "" || p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, fmt.Errorf("provider %d: name, issuer, client_id and redirect_url are required", i)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("provider %d: duplicate name %q", i, p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	return doc.Providers, nil
+}
+
+// LoadOIDCProviders reads and parses a provider file.
+func LoadOIDCProviders(path string) ([]OIDCProviderConfig, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, err
+	}
+	return ParseOIDCProviders(data)
+}
+
+// NewPKCEVerifier returns a random PKCE code verifier (RFC 7636).
+func NewPKCEVerifier() (string, error) {
+	verifier, _, err := NewOpaqueToken()
+	return verifier, err
+}
+
+// PKCEChallenge returns the S256 code challenge for a verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OIDCIdentity is the verified result of a login at an identity provider.
+type OIDCIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+type idTokenClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against one
+// provider. Discovery metadata and signing keys are fetched on first use;
+// keys are fetched again when a token names an unknown kid.
+type OIDCProvider struct {
+	config OIDCProviderConfig
+	client *http.Client
+	// Now is used for ID token validation; it defaults to time.Now.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	metadata *oidcMetadata
+	keys     *Keyring
+}
+
+// NewOIDCProvider creates a provider. A nil client uses http.DefaultClient.
+func NewOIDCProvider(cfg OIDCProviderConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{config: cfg, client: client, Now: time.Now}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL returns the provider URL the user is sent to for login.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", PKCEChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems an authorization code and verifies the returned ID token,
+// including its nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.do(req, &tokens); err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: missing from token response", ErrInvalidIDToken)
+	}
+
+	claims, err := p.verifyIDToken(ctx, tokens.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &OIDCIdentity{
+		Provider:          p.config.Name,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw string) (*idTokenClaims, error) {
+	keys, err := p.signingKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	parse := func(keys *Keyring) (*idTokenClaims, error) {
+		claims := &idTokenClaims{}
+		_, err := jwt.ParseWithClaims(raw, claims, keys.verificationKey,
+			jwt.WithIssuer(p.config.Issuer),
+			jwt.WithAudience(p.config.ClientID),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(1*time.Minute),
+			jwt.WithTimeFunc(p.Now),
+			jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		)
+		return claims, err
+	}
+
+	claims, err := parse(keys)
+	if errors.Is(err, ErrUnknownKeyID) {
+		// The provider may have rotated its keys since they were cached
+		if keys, err = p.signingKeys(ctx, true); err != nil {
+			return nil, err
+		}
+		claims, err = parse(keys)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	endpoint := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &oidcMetadata{}
+	if err := p.do(req, md); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", md.Issuer, p.config.Issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+
+	p.metadata = md
+	return md, nil
+}
+
+func (p *OIDCProvider) signingKeys(ctx context.Context, refresh bool) (*Keyring, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && !refresh {
+		return p.keys, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set JWKS
+	if err := p.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	p.keys = NewKeyringFromJWKS(set)
+	return p.keys, nil
+}
+
+// do sends req and decodes a JSON response body into dst.
+func (p *OIDCProvider) do(req *http.Request, dst any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := io.LimitReader(resp.Body, 1<<20)
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(body).Decode(dst)
+}
+
+// OIDCProviders looks up configured providers by name.
+type OIDCProviders map[string]*OIDCProvider
+
+// NewOIDCProviders creates a provider for every configuration entry.
+func NewOIDCProviders(configs []OIDCProviderConfig, client *http.Client) OIDCProviders {
+	providers := make(OIDCProviders, len(configs))
+	for _, cfg := range configs {
+		providers[cfg.Name] = NewOIDCProvider(cfg, client)
+	}
+	return providers
+}
+
+func (ps OIDCProviders) Get(name string) (*OIDCProvider, error) {
+	p, ok := ps[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
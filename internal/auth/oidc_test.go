@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider. Authorization codes
+// are registered directly with authorize, standing in for the user's login.
+type mockOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *Key
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+	// claims are added to every ID token, overriding the defaults
+	claims jwt.MapClaims
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewKey("mock-1", priv)
+	require.NoError(t, err)
+
+	m := &mockOIDCProvider{t: t, key: key, codes: map[string]mockAuthorization{}, claims: jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(NewKeyring().Add(m.signingKey()).JWKS())
+	})
+	mux.HandleFunc("POST /token", m.token)
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDCProvider) signingKey() *Key {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.key
+}
+
+// authorize parses the URL the client redirected to and returns a code for it.
+func (m *mockOIDCProvider) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	require.NoError(m.t, err)
+
+	q := u.Query()
+	require.Equal(m.t, "S256", q.Get("code_challenge_method"))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code = "code-" + q.Get("state")
+	m.codes[code] = mockAuthorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code, q.Get("state")
+}
+
+func (m *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(m.t, r.ParseForm())
+
+	m.mu.Lock()
+	authz, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	key := m.key
+	extra := m.claims
+	m.mu.Unlock()
+
+	if !ok || PKCEChallenge(r.PostForm.Get("code_verifier")) != authz.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            r.PostForm.Get("client_id"),
+		"sub":            "external-42",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"nonce":          authz.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	idToken, err := token.SignedString(key.private)
+	require.NoError(m.t, err)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+func (m *mockOIDCProvider) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCProviderConfig{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    "social-client",
+		RedirectURL: "http://localhost:8080/v1/auth/oidc/mock/callback",
+	}, m.server.Client())
+}
+
+func TestOIDCProvider_AuthorizationCodeFlow(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	p := mock.provider()
+	ctx := context.Background()
+
+	verifier, err := NewPKCEVerifier()
+	require.NoError(t, err)
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	require.NoError(t, err)
+	code, state := mock.authorize(authURL)
+	assert.Equal(t, "state-1", state)
+
+	identity, err := p.Exchange(ctx, code, verifier, "nonce-1")
+	require.NoError(t, err)
+	assert.Equal(t, "mock", identity.Provider)
+	assert.Equal(t, "external-42", identity.Subject)
+	assert.Equal(t, "alice@example.com", identity.Email)
+	assert.True(t, identity.EmailVerified)
+
+	// Codes are single use
+	_, err = p.Exchange(ctx, code, verifier, "nonce-1")
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_Exchange_WrongVerifier(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	p := mock.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "the-real-verifier")
+	require.NoError(t, err)
+	code, _ := mock.authorize(authURL)
+
+	_, err = p.Exchange(ctx, code, "another-verifier", "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCProvider_Exchange_NonceMismatch(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	p := mock.provider()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	require.NoError(t, err)
+	code, _ := mock.authorize(authURL)
+
+	_, err = p.Exchange(ctx, code, "verifier", "other-nonce")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestOIDCProvider_Exchange_RejectsWrongAudienceAndExpiry(t *testing.T) {
+	testCases := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"wrong audience", jwt.MapClaims{"aud": "someone-else"}},
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{"missing subject", jwt.MapClaims{"sub": ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := newMockOIDCProvider(t)
+			mock.claims = tc.claims
+			p := mock.provider()
+			ctx := context.Background()
+
+			authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+			require.NoError(t, err)
+			code, _ := mock.authorize(authURL)
+
+			_, err = p.Exchange(ctx, code, "verifier", "nonce")
+			assert.ErrorIs(t, err, ErrInvalidIDToken)
+		})
+	}
+}
+
+func TestOIDCProvider_RefetchesKeysAfterRotation(t *testing.T) {
+	mock := newMockOIDCProvider(t)
+	p := mock.provider()
+	ctx := context.Background()
+
+	login := func() error {
+		authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		require.NoError(t, err)
+		code, _ := mock.authorize(authURL)
+		_, err = p.Exchange(ctx, code, "verifier", "nonce")
+		return err
+	}
+	require.NoError(t, login())
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rotated, err := NewKey("mock-2", priv)
+	require.NoError(t, err)
+	mock.mu.Lock()
+	mock.key = rotated
+	mock.mu.Unlock()
+
+	assert.NoError(t, login())
+}
+
+func TestParseOIDCProviders(t *testing.T) {
+	t.Setenv("MOCK_CLIENT_SECRET", "s3cret")
+
+	providers, err := ParseOIDCProviders([]byte(`
+providers:
+  - name: mock
+    issuer: https://id.example.com
+    client_id: social
+    client_secret: ${MOCK_CLIENT_SECRET}
+    redirect_url: http://localhost:8080/v1/auth/oidc/mock/callback
+`))
+	require.NoError(t, err)
+	require.Len(t, providers, 1)
+	assert.Equal(t, "s3cret", providers[0].ClientSecret)
+
+	_, err = ParseOIDCProviders([]byte(`providers: [{name: mock}]`))
+	assert.Error(t, err)
+
+	_, err = NewOIDCProviders(providers, nil).Get("unknown")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// PolicyDocument is the on-disk representation of a policy. YAML and JSON are
+// both accepted.
+type PolicyDocument struct {
+	Rules []PolicyRule `yaml:"rules" json:"rules"`
+}
+
+// PolicyRule matches when the action, resource type and roles match and every
+// condition holds. Empty lists and "*" match anything; an action ending in
+// ":*" matches every action with that prefix.
+type PolicyRule struct {
+	Name       string   `yaml:"name" json:"name"`
+	Effect     string   `yaml:"effect" json:"effect"`
+	Actions    []string `yaml:"actions" json:"actions"`
+	Resources  []string `yaml:"resources" json:"resources"`
+	Roles      []string `yaml:"roles" json:"roles"`
+	Conditions []string `yaml:"conditions" json:"conditions"`
+}
+
+// ParsePolicy builds a policy engine from a YAML or JSON document.
+func ParsePolicy(data []byte) (*PolicyEngine, error) {
+	var doc PolicyDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+
+	e := NewPolicyEngine()
+	for i, pr := range doc.Rules {
+		rule, err := pr.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, pr.Name, err)
+		}
+
+		name := pr.Name
+		if name == "" {
+			name = fmt.Sprintf("rule#%d", i+1)
+		}
+
+		switch pr.Effect {
+		case EffectAllow, "":
+			e.AllowNamed(name, rule)
+		case EffectDeny:
+			e.DenyNamed(name, rule)
+		default:
+			return nil, fmt.Errorf("rule %d (%s): unknown effect %q", i, pr.Name, pr.Effect)
+		}
+	}
+
+	return e, nil
+}
+
+// LoadPolicyFile reads and parses a policy file.
+func LoadPolicyFile(path string) (*PolicyEngine, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path comes from operator configuration
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+func (pr PolicyRule) compile() (Rule, error) {
+	conds := make([]*Condition, 0, len(pr.Conditions))
+	for _, expr := range pr.Conditions {
+		c, err := ParseCondition(expr)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+	}
+
+	return func(s Subject, action string, r Resource) bool {
+		if !matchAction(pr.Actions, action) || !matchAny(pr.Resources, r.Type) {
+			return false
+		}
+
+		if len(pr.Roles) > 0 {
+			hasRole := false
+			for _, role := range pr.Roles {
+				if s.HasRole(role) {
+					hasRole = true
+					break
+				}
+			}
+			if !hasRole {
+				return false
+			}
+		}
+
+		for _, c := range conds {
+			if !c.Eval(s, action, r) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func matchAction(patterns []string, action string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == "*" || p == action {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok && strings.HasPrefix(action, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == "*" || p == value {
+			return true
+		}
+	}
+	return false
+}
+
+// FilePolicy is an Authorizer backed by a policy file that can be reloaded
+// while the server is running. A reload only takes effect if the whole file
+// parses; otherwise the previous policy stays in place.
+type FilePolicy struct {
+	path    string
+	current atomic.Pointer[PolicyEngine]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+func NewFilePolicy(path string) (*FilePolicy, error) {
+	p := &FilePolicy{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FilePolicy) Authorize(sub Subject, action string, res Resource) bool {
+	return p.current.Load().Authorize(sub, action, res)
+}
+
+func (p *FilePolicy) Decide(sub Subject, action string, res Resource) Decision {
+	return p.current.Load().Decide(sub, action, res)
+}
+
+// Path returns the policy file location.
+func (p *FilePolicy) Path() string {
+	return p.path
+}
+
+// Reload re-reads the policy file and atomically swaps in the new rules.
+func (p *FilePolicy) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+
+	engine, err := LoadPolicyFile(p.path)
+	if err != nil {
+		return err
+	}
+
+	p.current.Store(engine)
+	p.modTime = info.ModTime()
+	return nil
+}
+
+// ReloadIfChanged reloads the policy when the file's modification time changed
+// since the last successful load. It reports whether a reload happened.
+func (p *FilePolicy) ReloadIfChanged() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	changed := !info.ModTime().Equal(p.modTime)
+	// Remember the attempt so a broken file is not re-parsed on every check
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	if !changed {
+		return false, nil
+	}
+	return true, p.Reload()
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	sub := Subject{UserID: 1, Roles: []string{RoleUser}}
+	res := Resource{Type: "post", OwnerID: 1, Attr: map[string]any{"visibility": "public", "score": 10}}
+
+	testCases := []struct {
+		expr string
+		want bool
+	}{
+		{"subject.UserID == resource.OwnerID", true},
+		{"subject.UserID != resource.OwnerID", false},
+		{`resource.Attr.visibility == "public"`, true},
+		{`resource.Attr.visibility == 'private'`, false},
+		{"resource.Attr.missing == null", true},
+		{"resource.Attr.score >= 10", true},
+		{"resource.Attr.score < 5", false},
+		{`"user" in subject.Roles`, true},
+		{`"admin" in subject.Roles`, false},
+		{`action == "post:update"`, true},
+		{`resource.Type == "post"`, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCondition(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, c.Eval(sub, "post:update", res))
+		})
+	}
+}
+
+func TestParseCondition_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"subject.UserID",
+		"subject.UserID === resource.OwnerID",
+		"subject.Name == resource.OwnerID",
+		`resource.Type == "post`,
+	} {
+		_, err := ParseCondition(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestParsePolicy_DenyOverridesAllow(t *testing.T) {
+	engine, err := ParsePolicy([]byte(`
+rules:
+  - name: anyone-reads
+    effect: allow
+    actions: ["post:*"]
+    resources: [post]
+  - name: no-private
+    effect: deny
+    actions: [post:read]
+    conditions:
+      - resource.Attr.visibility == "private"
+      - subject.UserID != resource.OwnerID
+`))
+	require.NoError(t, err)
+
+	user := Subject{UserID: 1}
+	public := Resource{Type: "post", OwnerID: 2, Attr: map[string]any{"visibility": "public"}}
+	private := Resource{Type: "post", OwnerID: 2, Attr: map[string]any{"visibility": "private"}}
+	ownPrivate := Resource{Type: "post", OwnerID: 1, Attr: map[string]any{"visibility": "private"}}
+
+	assert.True(t, engine.Authorize(user, "post:read", public))
+	assert.False(t, engine.Authorize(user, "post:read", private))
+	assert.True(t, engine.Authorize(user, "post:read", ownPrivate))
+	assert.False(t, engine.Authorize(user, "user:follow", Resource{Type: "user"}))
+}
+
+func TestParsePolicy_JSON(t *testing.T) {
+	engine, err := ParsePolicy([]byte(`{"rules": [{"name": "admins", "effect": "allow", "roles": ["admin"]}]}`))
+	require.NoError(t, err)
+
+	assert.True(t, engine.Authorize(Subject{UserID: 1, Roles: []string{RoleAdmin}}, "anything", Resource{}))
+	assert.False(t, engine.Authorize(Subject{UserID: 1}, "anything", Resource{}))
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	_, err := ParsePolicy([]byte(`rules: [{name: bad, effect: maybe}]`))
+	assert.Error(t, err)
+
+	_, err = ParsePolicy([]byte(`rules: [{name: bad, conditions: ["subject.UserID"]}]`))
+	assert.Error(t, err)
+}
+
+// The shipped policy file must behave like the built-in default rules.
+func TestLoadPolicyFile_MatchesDefaultRules(t *testing.T) {
+	fromFile, err := LoadPolicyFile(filepath.Join("..", "..", "config", "policy.yaml"))
+	require.NoError(t, err)
+	builtin := NewDefaultPolicyEngine()
+
+	subjects := []Subject{
+		{},
+		{UserID: 1},
+		{UserID: 1, Roles: []string{RoleModerator}},
+		{UserID: 1, Roles: []string{RoleAdmin}},
+	}
+	resources := []Resource{
+		{Type: "post"},
+		{Type: "post", OwnerID: 1},
+		{Type: "post", OwnerID: 2},
+		{Type: "post", OwnerID: 1, Attr: map[string]any{"deleted_by": int64(1)}},
+		{Type: "post", OwnerID: 1, Attr: map[string]any{"deleted_by": int64(2)}},
+		{Type: "user", OwnerID: 1},
+		{Type: "user", OwnerID: 2},
+		{Type: "comment", OwnerID: 1, Attr: map[string]any{"post_owner_id": int64(2)}},
+		{Type: "comment", OwnerID: 2, Attr: map[string]any{"post_owner_id": int64(1)}},
+		{Type: "comment", OwnerID: 2, Attr: map[string]any{"post_owner_id": int64(3)}},
+		{Type: "bookmark", OwnerID: 1},
+		{Type: "bookmark", OwnerID: 2},
+		{Type: "bookmark_collection", OwnerID: 1},
+		{Type: "bookmark_collection", OwnerID: 2},
+	}
+	actions := []string{ActionPostCreate, ActionPostUpdate, ActionPostDelete, ActionPostRepost, ActionPostRestore, ActionCommentCreate, ActionCommentUpdate, ActionCommentDelete, ActionPostReact, ActionCommentReact, ActionBookmarkRead, ActionBookmarkWrite, ActionUserFollow, ActionUserUnfollow, ActionRoleAssign}
+
+	for _, s := range subjects {
+		for _, r := range resources {
+			for _, a := range actions {
+				assert.Equal(t, builtin.Authorize(s, a, r), fromFile.Authorize(s, a, r), "subject=%v action=%s resource=%v", s, a, r)
+			}
+		}
+	}
+}
+
+func TestFilePolicy_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`rules: [{name: a, actions: [post:create]}]`), 0o600))
+
+	policy, err := NewFilePolicy(path)
+	require.NoError(t, err)
+
+	user := Subject{UserID: 1}
+	assert.True(t, policy.Authorize(user, ActionPostCreate, Resource{}))
+	assert.False(t, policy.Authorize(user, ActionPostDelete, Resource{}))
+
+	// Unchanged file is not reloaded
+	reloaded, err := policy.ReloadIfChanged()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// A broken file keeps the previous policy
+	require.NoError(t, os.WriteFile(path, []byte(`rules: [{name: b, effect: nope}]`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	_, err = policy.ReloadIfChanged()
+	assert.Error(t, err)
+	assert.True(t, policy.Authorize(user, ActionPostCreate, Resource{}))
+
+	// A valid change is picked up
+	require.NoError(t, os.WriteFile(path, []byte(`rules: [{name: c, actions: [post:delete]}]`), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	reloaded, err = policy.ReloadIfChanged()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.False(t, policy.Authorize(user, ActionPostCreate, Resource{}))
+	assert.True(t, policy.Authorize(user, ActionPostDelete, Resource{}))
+}
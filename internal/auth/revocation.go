@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevocationList tracks access tokens, by JWT ID, that must be rejected before
+// they expire. Entries only need to be kept until the token's own expiry.
+type RevocationList interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	PurgeExpired(ctx context.Context) error
+}
+
+// MemoryRevocationList is a process-local RevocationList. It is only suitable
+// for single-instance deployments and tests.
+type MemoryRevocationList struct {
+	sync.RWMutex
+	entries map[string]time.Time
+	// Now provides current time; override in tests.
+	Now func() time.Time
+}
+
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{
+		entries: make(map[string]time.Time),
+		Now:     time.Now,
+	}
+}
+
+func (l *MemoryRevocationList) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	l.Lock()
+	l.entries[jti] = expiresAt
+	l.Unlock()
+	return nil
+}
+
+func (l *MemoryRevocationList) IsRevoked(_ context.Context, jti string) (bool, error) {
+	l.RLock()
+	expiresAt, ok := l.entries[jti]
+	l.RUnlock()
+
+	return ok && l.Now().Before(expiresAt), nil
+}
+
+// PurgeExpired drops entries for tokens that have expired on their own.
+func (l *MemoryRevocationList) PurgeExpired(_ context.Context) error {
+	now := l.Now()
+
+	l.Lock()
+	for jti, expiresAt := range l.entries {
+		if !now.Before(expiresAt) {
+			delete(l.entries, jti)
+		}
+	}
+	l.Unlock()
+	return nil
+}
+
+// Len returns the number of entries currently held.
+func (l *MemoryRevocationList) Len() int {
+	l.RLock()
+	defer l.RUnlock()
+	return len(l.entries)
+}
@@ -0,0 +1,56 @@
+package auth
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from JWTs in the Authorization header.
+const PersonalAccessTokenPrefix = "sgp_"
+
+// Scope constants for personal access tokens
+const (
+	ScopePostsWrite     = "posts:write"
+	ScopeCommentsWrite  = "comments:write"
+	ScopeReactionsWrite = "reactions:write"
+	ScopeUsersWrite     = "users:write"
+	ScopeFeedRead       = "feed:read"
+	ScopeRolesRead      = "roles:read"
+	ScopeRolesWrite     = "roles:write"
+)
+
+// Scopes lists every scope a personal access token can be granted.
+var Scopes = []string{ScopePostsWrite, ScopeCommentsWrite, ScopeReactionsWrite, ScopeUsersWrite, ScopeFeedRead, ScopeRolesRead, ScopeRolesWrite}
+
+// actionScopes maps each policy action to the scope a token needs for it.
+var actionScopes = map[string]string{
+	ActionPostCreate:    ScopePostsWrite,
+	ActionPostUpdate:    ScopePostsWrite,
+	ActionPostDelete:    ScopePostsWrite,
+	ActionPostRepost:    ScopePostsWrite,
+	ActionPostRestore:   ScopePostsWrite,
+	ActionCommentCreate: ScopeCommentsWrite,
+	ActionCommentUpdate: ScopeCommentsWrite,
+	ActionCommentDelete: ScopeCommentsWrite,
+	ActionPostReact:     ScopeReactionsWrite,
+	ActionCommentReact:  ScopeReactionsWrite,
+	ActionUserFollow:    ScopeUsersWrite,
+	ActionUserUnfollow:  ScopeUsersWrite,
+	ActionRoleRead:      ScopeRolesRead,
+	ActionRoleAssign:    ScopeRolesWrite,
+	ActionRoleRevoke:    ScopeRolesWrite,
+}
+
+// RequiredScope returns the scope needed to perform action with a personal
+// access token. Actions without a mapping can't be performed with one.
+func RequiredScope(action string) (string, bool) {
+	scope, ok := actionScopes[action]
+	return scope, ok
+}
+
+// NewPersonalAccessToken returns a prefixed random token and its hash.
+func NewPersonalAccessToken() (string, []byte, error) {
+	t, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := PersonalAccessTokenPrefix + t
+	return token, HashOpaqueToken(token), nil
+}
@@ -12,7 +12,10 @@ import (
 func Seed(store store.Storage) error {
 	ctx := context.Background()
 
-	users := generateUsers(100)
+	users, err := generateUsers(100)
+	if err != nil {
+		return err
+	}
 
 	for _, user := range users {
 		if err := store.Users.Create(ctx, user); err != nil {
@@ -39,7 +42,7 @@ func Seed(store store.Storage) error {
 	return nil
 }
 
-func generateUsers(count int) []*store.User {
+func generateUsers(count int) ([]*store.User, error) {
 	users := make([]*store.User, count)
 	now := time.Now().Format(time.RFC3339)
 
@@ -59,11 +62,15 @@ func generateUsers(count int) []*store.User {
 		users[i] = &store.User{
 			Username:  username.String(),
 			Email:     email.String(),
-			Password:  password.String(),
 			CreatedAt: now,
+			IsActive:  true,
+		}
+
+		if err := users[i].Password.Set(password.String()); err != nil {
+			return nil, err
 		}
 	}
-	return users
+	return users, nil
 }
 
 func generatePosts(count int, users []*store.User) []*store.Post {
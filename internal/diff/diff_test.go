@@ -0,0 +1,39 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLines(t *testing.T) {
+	testCases := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"identical", "a\nb", "a\nb", []Line{{OpEqual, "a"}, {OpEqual, "b"}}},
+		{"both empty", "", "", []Line{}},
+		{"from empty", "", "a", []Line{{OpInsert, "a"}}},
+		{"to empty", "a", "", []Line{{OpDelete, "a"}}},
+		{
+			name: "changed line",
+			a:    "first\nsecond\nthird",
+			b:    "first\n2nd\nthird",
+			want: []Line{{OpEqual, "first"}, {OpDelete, "second"}, {OpInsert, "2nd"}, {OpEqual, "third"}},
+		},
+		{
+			name: "insert and delete",
+			a:    "a\nb\nc\nd",
+			b:    "b\nc\nx\nd\ne",
+			want: []Line{{OpDelete, "a"}, {OpEqual, "b"}, {OpEqual, "c"}, {OpInsert, "x"}, {OpEqual, "d"}, {OpInsert, "e"}},
+		},
+		{"crlf", "a\r\nb", "a\nb", []Line{{OpEqual, "a"}, {OpEqual, "b"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, Lines(tc.a, tc.b))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"text/template"
+)
+
+const (
+	FromName               = "Social"
+	UserWelcomeTemplate    = "user_invitation.tmpl"
+	PasswordResetTemplate  = "password_reset.tmpl"
+	templateSubjectSection = "subject"
+	templateBodySection    = "body"
+)
+
+//go:embed templates
+var FS embed.FS
+
+// Message is a rendered email ready to be delivered.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Client delivers rendered messages.
+type Client interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Render builds a message for the given recipient from one of the embedded
+// templates. Each template defines a "subject" and a "body" block.
+func Render(templateFile, to string, data any) (Message, error) {
+	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	if err != nil {
+		return Message{}, err
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, templateSubjectSection, data); err != nil {
+		return Message{}, err
+	}
+
+	body := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(body, templateBodySection, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender_UserWelcomeTemplate(t *testing.T) {
+	data := struct {
+		Username      string
+		ActivationURL string
+		ExpiresIn     string
+	}{
+		Username:      "testuser",
+		ActivationURL: "http://localhost/confirm/abc",
+		ExpiresIn:     "72h",
+	}
+
+	msg, err := Render(UserWelcomeTemplate, "test@example.com", data)
+	require.NoError(t, err)
+
+	assert.Equal(t, "test@example.com", msg.To)
+	assert.Equal(t, "Welcome to Social, testuser!", msg.Subject)
+	assert.Contains(t, msg.Body, "http://localhost/confirm/abc")
+}
+
+func TestRender_UnknownTemplate(t *testing.T) {
+	_, err := Render("missing.tmpl", "test@example.com", nil)
+	assert.Error(t, err)
+}
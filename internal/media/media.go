@@ -0,0 +1,151 @@
+// Package media checks uploaded files and derives thumbnails from images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	// Registered so that image.Decode understands them
+	_ "image/gif"
+	_ "image/png"
+)
+
+// SniffLen is how many leading bytes Sniff looks at.
+const SniffLen = 512
+
+// MaxPixels caps the size of images that are decoded for a thumbnail, so a
+// small file can't expand into an enormous bitmap.
+const MaxPixels = 25_000_000
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrImageTooLarge   = errors.New("image dimensions are too large")
+)
+
+// allowedTypes are the content types accepted for uploads, as reported by
+// http.DetectContentType.
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"video/mp4":  true,
+}
+
+// thumbnailTypes are the image types the standard library can decode.
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Sniff detects the content type of a file from its first SniffLen bytes.
+// The type claimed by the client is never trusted.
+func Sniff(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	if !allowedTypes[contentType] {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// CanThumbnail reports whether Thumbnail supports contentType.
+func CanThumbnail(contentType string) bool {
+	return thumbnailTypes[contentType]
+}
+
+// Image is a decoded upload's dimensions and its JPEG thumbnail.
+type Image struct {
+	Width     int
+	Height    int
+	Thumbnail []byte
+}
+
+// Thumbnail decodes the image in r and scales it down to fit within
+// maxSize×maxSize. Images that already fit keep their size but are still
+// re-encoded as JPEG.
+func Thumbnail(r io.ReadSeeker, maxSize int) (*Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := fit(cfg.Width, cfg.Height, maxSize)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	// JPEG has no alpha channel, so transparent images are put on white
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	scale(dst, src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+
+	return &Image{Width: cfg.Width, Height: cfg.Height, Thumbnail: buf.Bytes()}, nil
+}
+
+// fit returns the size of a w×h image scaled to fit within maxSize×maxSize,
+// keeping its aspect ratio. Images are never scaled up.
+func fit(w, h, maxSize int) (int, int) {
+	if w <= maxSize && h <= maxSize {
+		return w, h
+	}
+	if w >= h {
+		return maxSize, max(1, h*maxSize/w)
+	}
+	return max(1, w*maxSize/h), maxSize
+}
+
+// scale draws src onto dst, averaging the source pixels that fall into each
+// destination pixel.
+func scale(dst *image.RGBA, src image.Image) {
+	sb := src.Bounds()
+	db := dst.Bounds()
+
+	for dy := 0; dy < db.Dy(); dy++ {
+		y0 := sb.Min.Y + dy*sb.Dy()/db.Dy()
+		y1 := max(y0+1, sb.Min.Y+(dy+1)*sb.Dy()/db.Dy())
+
+		for dx := 0; dx < db.Dx(); dx++ {
+			x0 := sb.Min.X + dx*sb.Dx()/db.Dx()
+			x1 := max(x0+1, sb.Min.X+(dx+1)*sb.Dx()/db.Dx())
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := src.At(x, y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			avg := color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)}
+			// Blend the premultiplied average over the white background
+			bg := dst.RGBA64At(db.Min.X+dx, db.Min.Y+dy)
+			inv := uint32(0xffff - avg.A)
+			dst.SetRGBA64(db.Min.X+dx, db.Min.Y+dy, color.RGBA64{
+				R: avg.R + uint16(uint32(bg.R)*inv/0xffff),
+				G: avg.G + uint16(uint32(bg.G)*inv/0xffff),
+				B: avg.B + uint16(uint32(bg.B)*inv/0xffff),
+				A: 0xffff,
+			})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	img := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+
+	contentType, err := Sniff(img)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+
+	_, err = Sniff([]byte("<html><body>not an image</body></html>"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	_, err = Sniff([]byte("%PDF-1.7"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+}
+
+func TestThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 800; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	img, err := Thumbnail(bytes.NewReader(encodePNG(t, src)), 320)
+	require.NoError(t, err)
+	assert.Equal(t, 800, img.Width)
+	assert.Equal(t, 400, img.Height)
+
+	thumb, err := jpeg.Decode(bytes.NewReader(img.Thumbnail))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 320, 160), thumb.Bounds())
+
+	r, g, b, _ := thumb.At(160, 80).RGBA()
+	assert.Greater(t, r>>8, uint32(240))
+	assert.Less(t, g>>8, uint32(20))
+	assert.Less(t, b>>8, uint32(20))
+}
+
+func TestThumbnail_TransparentOnWhite(t *testing.T) {
+	img, err := Thumbnail(bytes.NewReader(encodePNG(t, image.NewNRGBA(image.Rect(0, 0, 10, 10)))), 320)
+	require.NoError(t, err)
+
+	thumb, err := jpeg.Decode(bytes.NewReader(img.Thumbnail))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 10, 10), thumb.Bounds())
+
+	r, g, b, _ := thumb.At(5, 5).RGBA()
+	assert.Greater(t, r>>8, uint32(240))
+	assert.Greater(t, g>>8, uint32(240))
+	assert.Greater(t, b>>8, uint32(240))
+}
+
+func TestThumbnail_NotAnImage(t *testing.T) {
+	_, err := Thumbnail(bytes.NewReader([]byte("plain text")), 320)
+	assert.Error(t, err)
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		w, h, wantW, wantH int
+	}{
+		{100, 50, 100, 50},
+		{640, 480, 320, 240},
+		{480, 640, 240, 320},
+		{10000, 1, 320, 1},
+	}
+	for _, tt := range tests {
+		w, h := fit(tt.w, tt.h, 320)
+		assert.Equal(t, tt.wantW, w)
+		assert.Equal(t, tt.wantH, h)
+	}
+}
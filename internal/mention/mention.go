@@ -0,0 +1,103 @@
+// Package mention finds @username mentions in text.
+package mention
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxUsernameLen is the longest username a mention can refer to.
+const MaxUsernameLen = 100
+
+// ValidUsername reports whether s can be used as a username: 1 to
+// MaxUsernameLen letters, digits and underscores. These are exactly the
+// usernames Find recognizes after an @, so every user can be mentioned.
+func ValidUsername(s string) bool {
+	if s == "" || utf8.RuneCountInString(s) > MaxUsernameLen {
+		return false
+	}
+	for _, r := range s {
+		if !isUsernameRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// SanitizeUsername turns s into a valid username of at most maxLen runes by
+// replacing the characters a username can't have with underscores. It returns
+// "" when s has no letters or digits to keep.
+func SanitizeUsername(s string, maxLen int) string {
+	maxLen = min(maxLen, MaxUsernameLen)
+
+	var b strings.Builder
+	n, kept := 0, false
+	for _, r := range s {
+		if n == maxLen {
+			break
+		}
+		if isUsernameRune(r) && r != '_' {
+			kept = true
+		} else {
+			r = '_'
+		}
+		b.WriteRune(r)
+		n++
+	}
+	if !kept {
+		return ""
+	}
+	return b.String()
+}
+
+// Match is one @username in a text. Start and End are offsets in runes
+// (Unicode code points); the range includes the @ and End is exclusive.
+type Match struct {
+	Username string
+	Start    int
+	End      int
+}
+
+// Find returns the mentions in text in the order they appear. A mention is an
+// @ followed by letters, digits and underscores. The @ must not follow one of
+// those characters, so e-mail addresses aren't mistaken for mentions.
+func Find(text string) []Match {
+	runes := []rune(text)
+
+	var matches []Match
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '@' || (i > 0 && (isUsernameRune(runes[i-1]) || runes[i-1] == '@')) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && isUsernameRune(runes[end]) {
+			end++
+		}
+
+		length := end - i - 1
+		if length > 0 && length <= MaxUsernameLen && (end == len(runes) || runes[end] != '@') {
+			matches = append(matches, Match{Username: string(runes[i+1 : end]), Start: i, End: end})
+		}
+		i = end - 1
+	}
+	return matches
+}
+
+// Usernames returns the distinct usernames in matches.
+func Usernames(matches []Match) []string {
+	seen := make(map[string]bool, len(matches))
+	var usernames []string
+	for _, m := range matches {
+		if !seen[m.Username] {
+			seen[m.Username] = true
+			usernames = append(usernames, m.Username)
+		}
+	}
+	return usernames
+}
+
+func isUsernameRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,87 @@
+package mention
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Match
+	}{
+		{"none", "no mentions here", nil},
+		{"start", "@alice hi", []Match{{"alice", 0, 6}}},
+		{"several", "hi @alice and @bob_2!", []Match{{"alice", 3, 9}, {"bob_2", 14, 20}}},
+		{"punctuation", "(@alice), @bob.", []Match{{"alice", 1, 7}, {"bob", 10, 14}}},
+		{"email", "mail me at alice@example.com", nil},
+		{"lone at", "meet @ noon", nil},
+		{"double at", "@@alice", nil},
+		{"trailing at", "@alice@example", nil},
+		{"rune offsets", "héllo @çağrı", []Match{{"çağrı", 6, 12}}},
+		{"repeated", "@bob @bob", []Match{{"bob", 0, 4}, {"bob", 5, 9}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Find(tt.text))
+		})
+	}
+}
+
+func TestFind_TooLong(t *testing.T) {
+	assert.Empty(t, Find("@"+strings.Repeat("a", MaxUsernameLen+1)))
+	assert.Len(t, Find("@"+strings.Repeat("a", MaxUsernameLen)), 1)
+}
+
+func TestUsernames(t *testing.T) {
+	assert.Equal(t, []string{"bob", "alice"}, Usernames(Find("@bob @alice @bob")))
+}
+
+func TestValidUsername(t *testing.T) {
+	valid := []string{"alice", "bob_2", "çağrı", "_", strings.Repeat("a", MaxUsernameLen)}
+	for _, s := range valid {
+		assert.True(t, ValidUsername(s), s)
+	}
+
+	invalid := []string{"", "bob-2", "alice.smith", "a b", "@alice", "alice@example", strings.Repeat("a", MaxUsernameLen+1)}
+	for _, s := range invalid {
+		assert.False(t, ValidUsername(s), s)
+	}
+}
+
+func TestValidUsername_Mentionable(t *testing.T) {
+	// A valid username is found as a whole after an @
+	for _, s := range []string{"alice", "bob_2", "çağrı"} {
+		assert.Equal(t, []Match{{s, 0, len([]rune(s)) + 1}}, Find("@"+s), s)
+	}
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"alice", 10, "alice"},
+		{"alice.smith", 20, "alice_smith"},
+		{"jean-luc picard", 20, "jean_luc_picard"},
+		{"çağrı", 3, "çağ"},
+		{"abcdef", 3, "abc"},
+		{"...", 10, ""},
+		{"", 10, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := SanitizeUsername(tt.in, tt.maxLen)
+			assert.Equal(t, tt.want, got)
+			if got != "" {
+				assert.True(t, ValidUsername(got))
+			}
+		})
+	}
+}
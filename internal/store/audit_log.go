@@ -0,0 +1,23 @@
+package store
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/audit"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// AuditLogStore persists authorization decisions.
+type AuditLogStore struct {
+	db *db.DB
+}
+
+func (s *AuditLogStore) Record(ctx context.Context, e audit.Entry) error {
+	query := `
+	INSERT INTO authz_audit_log (created_at, request_id, user_id, roles, action, resource_type, resource_owner_id, allowed, rule, reason)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err := s.db.Exec(ctx, query, e.Time, e.RequestID, e.UserID, pq.Array(e.Roles), e.Action, e.ResourceType, e.ResourceOwnerID, e.Allowed, e.Rule, e.Reason)
+	return err
+}
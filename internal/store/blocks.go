@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// Block is a user BlockerID has blocked. Blocked users can't mention the
+// blocker.
+type Block struct {
+	BlockerID int64     `json:"-"`
+	User      User      `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BlockStore struct {
+	db *db.DB
+}
+
+// Block stores that blockerID blocked blockedID. Blocking someone again does
+// nothing, and blocking a user that doesn't exist returns ErrNotFound.
+func (s *BlockStore) Block(ctx context.Context, blockerID, blockedID int64) error {
+	query := `
+	INSERT INTO user_blocks (blocker_id, blocked_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	_, err := s.db.Exec(ctx, query, blockerID, blockedID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Unblock removes a block. Removing one that doesn't exist does nothing.
+func (s *BlockStore) Unblock(ctx context.Context, blockerID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+	_, err := s.db.Exec(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// GetByUserID lists the users blockerID has blocked, most recent first.
+func (s *BlockStore) GetByUserID(ctx context.Context, blockerID int64) ([]*Block, error) {
+	query := `
+	SELECT b.blocker_id, u.id, u.username, b.created_at
+	FROM user_blocks b
+	JOIN users u ON u.id = b.blocked_id
+	WHERE b.blocker_id = $1
+	ORDER BY b.created_at DESC, u.id`
+
+	rows, err := s.db.Query(ctx, query, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocks := []*Block{}
+	for rows.Next() {
+		b := &Block{}
+		if err := rows.Scan(&b.BlockerID, &b.User.ID, &b.User.Username, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
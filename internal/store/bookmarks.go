@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+var ErrDuplicateCollection = errors.New("a collection with that name already exists")
+
+// Bookmark is a post a user saved for later, optionally in one of their
+// collections.
+type Bookmark struct {
+	ID           int64     `json:"id"`
+	UserID       int64     `json:"-"`
+	PostID       int64     `json:"post_id"`
+	CollectionID *int64    `json:"collection_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	// Post is loaded when listing bookmarks.
+	Post *PostWithMetadata `json:"post,omitempty"`
+}
+
+// BookmarkPage is one page of bookmarks and the cursor of the next page,
+// which is empty on the last page.
+type BookmarkPage struct {
+	Bookmarks  []Bookmark `json:"bookmarks"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+type BookmarkStore struct {
+	db *db.DB
+}
+
+// Save bookmarks a post, or moves an existing bookmark of the post to
+// bookmark.CollectionID. It returns ErrNotFound if the collection doesn't
+// belong to the user.
+func (s *BookmarkStore) Save(ctx context.Context, bookmark *Bookmark) error {
+	query := `
+	INSERT INTO bookmarks (user_id, post_id, collection_id)
+	SELECT $1, $2, $3
+	WHERE $3::bigint IS NULL OR EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1)
+	ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id
+	RETURNING id, created_at`
+
+	err := s.db.QueryRow(ctx, query, bookmark.UserID, bookmark.PostID, bookmark.CollectionID).Scan(&bookmark.ID, &bookmark.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BookmarkStore) GetByID(ctx context.Context, id int64) (*Bookmark, error) {
+	query := `
+	SELECT b.id, b.user_id, b.post_id, b.collection_id, b.created_at
+	FROM bookmarks b
+	JOIN posts p ON p.id = b.post_id AND p.deleted_at IS NULL
+	WHERE b.id = $1`
+
+	bookmark := &Bookmark{}
+	err := s.db.QueryRow(ctx, query, id).Scan(&bookmark.ID, &bookmark.UserID, &bookmark.PostID, &bookmark.CollectionID, &bookmark.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return bookmark, nil
+}
+
+// Move puts a bookmark into bookmark.CollectionID, or takes it out of its
+// collection when that is nil. It returns ErrNotFound if the collection
+// doesn't belong to the bookmark's owner.
+func (s *BookmarkStore) Move(ctx context.Context, bookmark *Bookmark) error {
+	query := `
+	UPDATE bookmarks SET collection_id = $2
+	WHERE id = $1
+	AND ($2::bigint IS NULL OR EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $2 AND user_id = bookmarks.user_id))`
+
+	res, err := s.db.Exec(ctx, query, bookmark.ID, bookmark.CollectionID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *BookmarkStore) Delete(ctx context.Context, id int64) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM bookmarks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetByUserID returns a page of a user's bookmarks with their posts, newest
+// first, quote posts embedding the post they quote. Bookmarks of deleted posts
+// are left out.
+func (s *BookmarkStore) GetByUserID(ctx context.Context, userID int64, bq PaginatedBookmarkQuery) (*BookmarkPage, error) {
+	after, err := decodeCursor(bq.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// One row more than requested tells whether there is a next page
+	query := `
+	SELECT b.id, b.user_id, b.post_id, b.collection_id, b.created_at,
+		p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.status, p.publish_at, p.tags, u.username,
+		(SELECT count(*) FROM comments c WHERE c.post_id = p.id), p.quoted_post_id, ` + quoteColumns + `
+	FROM bookmarks b
+	JOIN posts p ON p.id = b.post_id AND p.deleted_at IS NULL
+	JOIN users u ON u.id = p.user_id` + quoteJoins + `
+	WHERE b.user_id = $1 AND ($2 = 0 OR b.id < $2) AND ($3::bigint IS NULL OR b.collection_id = $3)
+	ORDER BY b.id DESC
+	LIMIT $4`
+
+	rows, err := s.db.Query(ctx, query, userID, after, bq.CollectionID, bq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &BookmarkPage{Bookmarks: []Bookmark{}}
+	for rows.Next() {
+		b := Bookmark{Post: &PostWithMetadata{}}
+		p := b.Post
+		var quote quoteRow
+		dest := append([]any{&b.ID, &b.UserID, &b.PostID, &b.CollectionID, &b.CreatedAt,
+			&p.ID, &p.UserID, &p.Title, &p.Content, &p.CreatedAt, &p.Version, &p.Status, &p.PublishAt, pq.Array(&p.Tags), &p.User.Username,
+			&p.CommentCount, &p.QuotedPostID}, quote.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		p.User.ID = p.UserID
+		p.QuotedPost = quote.summary(p.QuotedPostID)
+		page.Bookmarks = append(page.Bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Bookmarks) > bq.Limit {
+		page.Bookmarks = page.Bookmarks[:bq.Limit]
+		page.NextCursor = encodeCursor(page.Bookmarks[bq.Limit-1].ID)
+	}
+	return page, nil
+}
+
+// BookmarkCollection is a named group of a user's bookmarks.
+type BookmarkCollection struct {
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"-"`
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"created_at"`
+	BookmarkCount int       `json:"bookmark_count"`
+}
+
+type BookmarkCollectionStore struct {
+	db *db.DB
+}
+
+func (s *BookmarkCollectionStore) Create(ctx context.Context, collection *BookmarkCollection) error {
+	query := `
+	INSERT INTO bookmark_collections (user_id, name)
+	VALUES ($1, $2)
+	RETURNING id, created_at`
+
+	err := s.db.QueryRow(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+	return collectionConstraintError(err)
+}
+
+func (s *BookmarkCollectionStore) GetByID(ctx context.Context, id int64) (*BookmarkCollection, error) {
+	query := `
+	SELECT bc.id, bc.user_id, bc.name, bc.created_at,
+		(SELECT count(*) FROM bookmarks b JOIN posts p ON p.id = b.post_id AND p.deleted_at IS NULL WHERE b.collection_id = bc.id)
+	FROM bookmark_collections bc
+	WHERE bc.id = $1`
+
+	collection := &BookmarkCollection{}
+	err := s.db.QueryRow(ctx, query, id).Scan(&collection.ID, &collection.UserID, &collection.Name, &collection.CreatedAt, &collection.BookmarkCount)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return collection, nil
+}
+
+// GetByUserID lists a user's collections by name.
+func (s *BookmarkCollectionStore) GetByUserID(ctx context.Context, userID int64) ([]*BookmarkCollection, error) {
+	query := `
+	SELECT bc.id, bc.user_id, bc.name, bc.created_at,
+		(SELECT count(*) FROM bookmarks b JOIN posts p ON p.id = b.post_id AND p.deleted_at IS NULL WHERE b.collection_id = bc.id)
+	FROM bookmark_collections bc
+	WHERE bc.user_id = $1
+	ORDER BY bc.name`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*BookmarkCollection{}
+	for rows.Next() {
+		collection := &BookmarkCollection{}
+		if err := rows.Scan(&collection.ID, &collection.UserID, &collection.Name, &collection.CreatedAt, &collection.BookmarkCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, collection)
+	}
+	return collections, rows.Err()
+}
+
+func (s *BookmarkCollectionStore) Rename(ctx context.Context, collection *BookmarkCollection) error {
+	res, err := s.db.Exec(ctx, `UPDATE bookmark_collections SET name = $2 WHERE id = $1`, collection.ID, collection.Name)
+	if err != nil {
+		return collectionConstraintError(err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a collection. Its bookmarks are kept outside of any
+// collection.
+func (s *BookmarkCollectionStore) Delete(ctx context.Context, id int64) error {
+	res, err := s.db.Exec(ctx, `DELETE FROM bookmark_collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// collectionConstraintError maps unique violations on collection names to
+// ErrDuplicateCollection.
+func collectionConstraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "bookmark_collections_user_id_name_key" {
+		return ErrDuplicateCollection
+	}
+	return err
+}
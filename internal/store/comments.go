@@ -2,18 +2,61 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/yusuf-cirak/social/internal/db"
 )
 
 type Comment struct {
-	ID        int64     `json:"id"`
-	PostID    int64     `json:"post_id"`
-	UserID    int64     `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	User      User      `json:"user"`
+	ID       int64  `json:"id"`
+	PostID   int64  `json:"post_id"`
+	ParentID *int64 `json:"parent_id"`
+	// Depth is 0 for comments on the post and one more than the parent's for replies.
+	Depth      int       `json:"depth"`
+	UserID     int64     `json:"user_id"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	ReplyCount int       `json:"reply_count"`
+	User       User      `json:"user"`
+	Reactions  Reactions `json:"reactions,omitzero"`
+	Entities   Entities  `json:"entities,omitzero"`
+	// Replies holds the loaded replies, oldest first, when listing a thread.
+	Replies []Comment `json:"replies,omitempty"`
+	// PostOwnerID and PostStatus describe the post the comment belongs to.
+	// They are only loaded by GetByID, for authorization and visibility.
+	PostOwnerID int64  `json:"-"`
+	PostStatus  string `json:"-"`
+}
+
+// CommentPage is one page of comments and the cursor of the next page, which
+// is empty on the last page.
+type CommentPage struct {
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Flatten returns the comments of the page and their loaded replies as one
+// list in thread order, each reply following its parent.
+func (p *CommentPage) Flatten() []Comment {
+	flat := make([]Comment, 0, len(p.Comments))
+
+	var walk func([]Comment)
+	walk = func(comments []Comment) {
+		for _, c := range comments {
+			replies := c.Replies
+			c.Replies = nil
+			flat = append(flat, c)
+			walk(replies)
+		}
+	}
+	walk(p.Comments)
+
+	return flat
 }
 
 type CommentStore struct {
@@ -24,48 +67,221 @@ func NewCommentStore(db *db.DB) *CommentStore {
 	return &CommentStore{db: db}
 }
 
+// Create stores a comment. Replies set ParentID and get their depth from the
+// parent, which must belong to the same post. The users in
+// comment.Entities.Mentions are notified.
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
-	query := `INSERT INTO comments (post_id, user_id, content) VALUES ($1, $2, $3) 
-	RETURNING id, created_at`
-	err := s.db.QueryRow(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO comments (post_id, parent_id, user_id, content, depth)
+		VALUES ($1, $2, $3, $4, COALESCE((SELECT depth + 1 FROM comments WHERE id = $2 AND post_id = $1), 0))
+		RETURNING id, depth, created_at, updated_at`
+		err := tx.QueryRowContext(ctx, query, comment.PostID, comment.ParentID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.Depth, &comment.CreatedAt, &comment.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		return saveMentions(ctx, tx, mentionTarget{postID: comment.PostID, commentID: &comment.ID}, comment.UserID, comment.Entities.Mentions)
+	})
+}
+
+func (s *CommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	query := `
+	SELECT c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.created_at, c.updated_at, u.username, u.id,
+		(SELECT count(*) FROM comments r WHERE r.parent_id = c.id), p.user_id, p.status
+	FROM comments c
+	JOIN users u ON c.user_id = u.id
+	JOIN posts p ON c.post_id = p.id AND p.deleted_at IS NULL
+	WHERE c.id = $1
+	`
+
+	comment := &Comment{}
+	err := s.db.QueryRow(ctx, query, id).Scan(&comment.ID, &comment.PostID, &comment.ParentID, &comment.Depth, &comment.UserID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt, &comment.User.Username, &comment.User.ID, &comment.ReplyCount, &comment.PostOwnerID, &comment.PostStatus)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
-	return nil
+	return comment, nil
+}
+
+// GetByPostID returns a page of the top-level comments on a post, newest first
+// unless cq.Sort is "asc", with cq.Depth levels of replies below each.
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64, cq PaginatedCommentQuery) (*CommentPage, error) {
+	return s.getPage(ctx, "c.post_id = $1 AND c.parent_id IS NULL", postID, cq)
+}
+
+// GetReplies returns a page of the direct replies to a comment, with cq.Depth
+// levels of replies below each.
+func (s *CommentStore) GetReplies(ctx context.Context, commentID int64, cq PaginatedCommentQuery) (*CommentPage, error) {
+	return s.getPage(ctx, "c.parent_id = $1", commentID, cq)
+}
+
+func (s *CommentStore) getPage(ctx context.Context, where string, id int64, cq PaginatedCommentQuery) (*CommentPage, error) {
+	after, err := decodeCursor(cq.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp, order := "<", "DESC"
+	if cq.Sort == "asc" {
+		cmp, order = ">", "ASC"
+	}
+
+	// One row more than requested tells whether there is a next page
+	query := fmt.Sprintf(`
+	SELECT c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.created_at, c.updated_at, u.username, u.id,
+		(SELECT count(*) FROM comments r WHERE r.parent_id = c.id)
+	FROM comments c
+	JOIN users u ON c.user_id = u.id
+	WHERE %s AND ($2 = 0 OR c.id %s $2)
+	ORDER BY c.id %s
+	LIMIT $3
+	`, where, cmp, order)
+
+	comments, err := s.query(ctx, query, id, after, cq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CommentPage{Comments: comments}
+	if len(page.Comments) > cq.Limit {
+		page.Comments = page.Comments[:cq.Limit]
+		page.NextCursor = encodeCursor(page.Comments[cq.Limit-1].ID)
+	}
+
+	if err := s.loadReplies(ctx, page.Comments, cq.Depth); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// Listings load a bounded part of each thread. Comments report their full
+// ReplyCount, and the rest of their replies are paged through GetReplies.
+const (
+	// RepliesPerComment is how many replies are loaded below each comment,
+	// oldest first.
+	RepliesPerComment = 3
+	// maxLoadedReplies caps the replies loaded for one listing, over all
+	// levels.
+	maxLoadedReplies = 500
+)
+
+// loadReplies fills in the replies of comments down to depth levels, one
+// level at a time, with at most RepliesPerComment replies below each comment.
+func (s *CommentStore) loadReplies(ctx context.Context, comments []Comment, depth int) error {
 	query := `
-	SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.id FROM comments c
+	SELECT c.id, c.post_id, c.parent_id, c.depth, c.user_id, c.content, c.created_at, c.updated_at, u.username, u.id,
+		(SELECT count(*) FROM comments r WHERE r.parent_id = c.id)
+	FROM (
+		SELECT c.*, row_number() OVER (PARTITION BY c.parent_id ORDER BY c.id) AS n
+		FROM comments c
+		WHERE c.parent_id = ANY($1)
+	) c
 	JOIN users u ON c.user_id = u.id
-	WHERE post_id = $1
-	ORDER BY c.created_at DESC
+	WHERE c.n <= $2
+	ORDER BY c.n, c.id
+	LIMIT $3
 	`
-	rows, err := s.db.Query(ctx, query, postID)
+
+	level := make([]*Comment, len(comments))
+	for i := range comments {
+		level[i] = &comments[i]
+	}
+
+	remaining := maxLoadedReplies
+	for ; depth > 0 && len(level) > 0 && remaining > 0; depth-- {
+		ids := make([]int64, len(level))
+		for i, c := range level {
+			ids[i] = c.ID
+		}
+
+		replies, err := s.query(ctx, query, pq.Array(ids), RepliesPerComment, remaining)
+		if err != nil {
+			return err
+		}
+		remaining -= len(replies)
+
+		// Rows come in reply order within each parent
+		byParent := make(map[int64][]Comment)
+		for _, reply := range replies {
+			byParent[*reply.ParentID] = append(byParent[*reply.ParentID], reply)
+		}
+
+		var next []*Comment
+		for _, c := range level {
+			c.Replies = byParent[c.ID]
+			for i := range c.Replies {
+				next = append(next, &c.Replies[i])
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+func (s *CommentStore) query(ctx context.Context, query string, args ...any) ([]Comment, error) {
+	rows, err := s.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []Comment
+	comments := []Comment{}
 	for rows.Next() {
-		var comment Comment
-		comment.User = User{}
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt, &comment.User.Username, &comment.User.ID); err != nil {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.PostID, &c.ParentID, &c.Depth, &c.UserID, &c.Content, &c.CreatedAt, &c.UpdatedAt, &c.User.Username, &c.User.ID, &c.ReplyCount); err != nil {
 			return nil, err
 		}
-		comments = append(comments, comment)
+		comments = append(comments, c)
 	}
+	return comments, rows.Err()
+}
+
+// Update saves the content of a comment and replaces its mentions by
+// comment.Entities.Mentions. Newly mentioned users are notified.
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	err := s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE comments
+		SET content = $1, updated_at = now()
+		WHERE id = $2
+		RETURNING updated_at
+		`
+		if err := tx.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.UpdatedAt); err != nil {
+			return err
+		}
 
-	return comments, nil
+		return saveMentions(ctx, tx, mentionTarget{postID: comment.PostID, commentID: &comment.ID}, comment.UserID, comment.Entities.Mentions)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *CommentStore) Delete(ctx context.Context, postID int64) error {
+// Delete removes a comment together with its replies.
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
 	query := `
 	DELETE FROM comments
-	WHERE post_id = $1
+	WHERE id = $1
 	`
-	res, err := s.db.Exec(ctx, query, postID)
+	res, err := s.db.Exec(ctx, query, commentID)
 
 	if err != nil {
 		return err
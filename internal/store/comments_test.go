@@ -0,0 +1,38 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentPage_Flatten(t *testing.T) {
+	page := &CommentPage{
+		Comments: []Comment{
+			{ID: 1, Replies: []Comment{
+				{ID: 3, Replies: []Comment{{ID: 6}}},
+				{ID: 4},
+			}},
+			{ID: 2, Replies: []Comment{{ID: 5}}},
+		},
+		NextCursor: "next",
+	}
+
+	flat := page.Flatten()
+
+	ids := make([]int64, len(flat))
+	for i, c := range flat {
+		ids[i] = c.ID
+		assert.Nil(t, c.Replies, "comment %d keeps its replies", c.ID)
+	}
+	assert.Equal(t, []int64{1, 3, 6, 4, 2, 5}, ids)
+
+	// The nested page itself is left alone
+	assert.Len(t, page.Comments[0].Replies, 2)
+}
+
+func TestCommentPage_FlattenEmpty(t *testing.T) {
+	page := &CommentPage{Comments: []Comment{}}
+	assert.NotNil(t, page.Flatten(), "an empty page flattens to an empty list, not null")
+	assert.Empty(t, page.Flatten())
+}
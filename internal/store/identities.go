@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	Provider  string
+	Subject   string
+	UserID    int64
+	Email     string
+	CreatedAt time.Time
+}
+
+// OIDCLoginState is kept between redirecting a user to an identity provider
+// and handling the callback. Only a hash of the state parameter is stored.
+type OIDCLoginState struct {
+	StateHash    []byte
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+type IdentityStore struct {
+	db *db.DB
+}
+
+// GetUserID returns the user linked to an external identity.
+func (s *IdentityStore) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	query := `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	var userID int64
+	err := s.db.QueryRow(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// Link attaches an external identity to an existing user.
+func (s *IdentityStore) Link(ctx context.Context, identity *Identity) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4) RETURNING created_at`
+	return s.db.QueryRow(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email).Scan(&identity.CreatedAt)
+}
+
+// CreateUser creates an active user with the default role and links the
+// external identity to it.
+func (s *IdentityStore) CreateUser(ctx context.Context, user *User, identity *Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO users (username, email, password, is_active) VALUES ($1, $2, $3, true) RETURNING id, created_at`
+		err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash).Scan(&user.ID, &user.CreatedAt)
+		if err != nil {
+			return userConstraintError(err)
+		}
+		user.IsActive = true
+
+		query = `INSERT INTO user_roles (user_id, role) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(ctx, query, user.ID, DefaultRole); err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		query = `INSERT INTO user_identities (provider, subject, user_id, email) VALUES ($1, $2, $3, $4) RETURNING created_at`
+		return tx.QueryRowContext(ctx, query, identity.Provider, identity.Subject, identity.UserID, identity.Email).Scan(&identity.CreatedAt)
+	})
+}
+
+func (s *IdentityStore) SaveLoginState(ctx context.Context, state *OIDCLoginState) error {
+	query := `INSERT INTO oidc_login_states (state, provider, code_verifier, nonce, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.db.Exec(ctx, query, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.ExpiresAt)
+	return err
+}
+
+// ConsumeLoginState deletes and returns an unexpired login state so that
+// every state can be used only once.
+func (s *IdentityStore) ConsumeLoginState(ctx context.Context, provider string, stateHash []byte) (*OIDCLoginState, error) {
+	query := `
+	DELETE FROM oidc_login_states
+	WHERE state = $1 AND provider = $2 AND expires_at > now()
+	RETURNING state, provider, code_verifier, nonce, expires_at`
+
+	state := &OIDCLoginState{}
+	err := s.db.QueryRow(ctx, query, stateHash, provider).Scan(&state.StateHash, &state.Provider, &state.CodeVerifier, &state.Nonce, &state.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+func (s *IdentityStore) PurgeExpiredLoginStates(ctx context.Context) error {
+	query := `DELETE FROM oidc_login_states WHERE expires_at <= now()`
+	_, err := s.db.Exec(ctx, query)
+	return err
+}
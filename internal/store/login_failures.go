@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// LoginFailureStore counts failed logins per key, such as an account or an IP
+// address, and the time until which further attempts are refused.
+type LoginFailureStore struct {
+	db *db.DB
+}
+
+// LockedUntil returns the latest lock among keys, or the zero time if none of
+// them is locked.
+func (s *LoginFailureStore) LockedUntil(ctx context.Context, keys []string) (time.Time, error) {
+	query := `SELECT max(locked_until) FROM login_failures WHERE key = ANY($1) AND locked_until > now()`
+
+	var until sql.NullTime
+	if err := s.db.QueryRow(ctx, query, pq.Array(keys)).Scan(&until); err != nil {
+		return time.Time{}, err
+	}
+	return until.Time, nil
+}
+
+// RecordFailure counts a failed attempt and returns the number of consecutive
+// failures. Failures older than window are forgotten.
+func (s *LoginFailureStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	query := `
+	INSERT INTO login_failures (key, failures, last_failed_at) VALUES ($1, 1, now())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_failures.last_failed_at < now() - $2 * interval '1 second' THEN 1
+			ELSE login_failures.failures + 1
+		END,
+		last_failed_at = now()
+	RETURNING failures`
+
+	var failures int
+	err := s.db.QueryRow(ctx, query, key, int64(window.Seconds())).Scan(&failures)
+	return failures, err
+}
+
+func (s *LoginFailureStore) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE login_failures SET locked_until = $2 WHERE key = $1`
+	_, err := s.db.Exec(ctx, query, key, until)
+	return err
+}
+
+func (s *LoginFailureStore) Reset(ctx context.Context, key string) error {
+	query := `DELETE FROM login_failures WHERE key = $1`
+	_, err := s.db.Exec(ctx, query, key)
+	return err
+}
+
+// PurgeStale removes counters whose last failure is older than olderThan and
+// that are no longer locked.
+func (s *LoginFailureStore) PurgeStale(ctx context.Context, olderThan time.Duration) error {
+	query := `
+	DELETE FROM login_failures
+	WHERE last_failed_at < now() - $1 * interval '1 second'
+	AND (locked_until IS NULL OR locked_until <= now())`
+	_, err := s.db.Exec(ctx, query, int64(olderThan.Seconds()))
+	return err
+}
+
+// SecurityEvent records something security relevant that happened to an
+// account or came from an IP address, such as a login lockout.
+type SecurityEvent struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	UserID    *int64    `json:"user_id"`
+	IP        string    `json:"ip"`
+	RequestID string    `json:"request_id"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	SecurityEventLoginLockout = "login_lockout"
+)
+
+type SecurityEventStore struct {
+	db *db.DB
+}
+
+func (s *SecurityEventStore) Create(ctx context.Context, event *SecurityEvent) error {
+	query := `
+	INSERT INTO security_events (type, user_id, ip, request_id, details)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	return s.db.QueryRow(ctx, query, event.Type, event.UserID, event.IP, event.RequestID, event.Details).Scan(&event.ID, &event.CreatedAt)
+}
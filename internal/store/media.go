@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// ErrMediaUnavailable is returned when a post is created with media that
+// doesn't exist, belongs to someone else or is attached to another post.
+var ErrMediaUnavailable = errors.New("media not found or already attached")
+
+// Media is an uploaded file. Its bytes are kept in the blob store under Key,
+// and those of its thumbnail, if it has one, under ThumbnailKey.
+type Media struct {
+	ID           int64   `json:"id"`
+	UserID       int64   `json:"user_id"`
+	Key          string  `json:"-"`
+	ThumbnailKey *string `json:"-"`
+	ContentType  string  `json:"content_type"`
+	SizeBytes    int64   `json:"size_bytes"`
+	// Width and Height are only known for images.
+	Width     *int   `json:"width,omitempty"`
+	Height    *int   `json:"height,omitempty"`
+	PostID    *int64 `json:"post_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+	// URL and ThumbnailURL are filled in by the API.
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+const mediaColumns = `id, user_id, key, thumbnail_key, content_type, size_bytes, width, height, post_id, created_at`
+
+func scanMedia(row rowScanner) (*Media, error) {
+	m := &Media{}
+	err := row.Scan(&m.ID, &m.UserID, &m.Key, &m.ThumbnailKey, &m.ContentType, &m.SizeBytes, &m.Width, &m.Height, &m.PostID, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+type MediaStore struct {
+	db *db.DB
+}
+
+// Create stores an upload whose blobs have already been written. The media
+// is unattached until a post is created with it.
+func (s *MediaStore) Create(ctx context.Context, m *Media) error {
+	query := `
+	INSERT INTO media (user_id, key, thumbnail_key, content_type, size_bytes, width, height)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id, created_at`
+
+	return s.db.QueryRow(ctx, query, m.UserID, m.Key, m.ThumbnailKey, m.ContentType, m.SizeBytes, m.Width, m.Height).Scan(&m.ID, &m.CreatedAt)
+}
+
+func (s *MediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE id = $1`
+
+	m, err := scanMedia(s.db.QueryRow(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// GetByPostIDs returns the media attached to each of postIDs, in the order
+// they were given when the post was created. Posts without media are left
+// out of the result.
+func (s *MediaStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]*Media, error) {
+	media := make(map[int64][]*Media)
+	if len(postIDs) == 0 {
+		return media, nil
+	}
+
+	query := `
+	SELECT ` + mediaColumns + `
+	FROM media
+	WHERE post_id = ANY($1)
+	ORDER BY post_id, position`
+
+	rows, err := s.db.Query(ctx, query, pq.Array(postIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		media[*m.PostID] = append(media[*m.PostID], m)
+	}
+	return media, rows.Err()
+}
+
+// PurgeOrphans removes up to limit media rows that have not been attached to
+// a post within olderThan of being uploaded, or whose post was purged. The
+// removed rows are returned so that their blobs can be deleted.
+func (s *MediaStore) PurgeOrphans(ctx context.Context, olderThan time.Duration, limit int) ([]*Media, error) {
+	query := `
+	DELETE FROM media
+	WHERE id IN (
+		SELECT id FROM media
+		WHERE post_id IS NULL AND created_at <= now() - $1 * interval '1 second'
+		ORDER BY created_at
+		LIMIT $2
+	)
+	RETURNING ` + mediaColumns
+
+	rows, err := s.db.Query(ctx, query, int64(olderThan.Seconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	purged := []*Media{}
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, m)
+	}
+	return purged, rows.Err()
+}
+
+// attachMedia attaches post.Media, identified by their IDs, to post in the
+// order given, and loads the rest of their fields. Only unattached media
+// uploaded by the post's author can be attached.
+func attachMedia(ctx context.Context, tx *sql.Tx, post *Post) error {
+	query := `
+	UPDATE media SET post_id = $1, position = $2
+	WHERE id = $3 AND user_id = $4 AND post_id IS NULL
+	RETURNING ` + mediaColumns
+
+	for i, m := range post.Media {
+		attached, err := scanMedia(tx.QueryRowContext(ctx, query, post.ID, i, m.ID, post.UserID))
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrMediaUnavailable
+			default:
+				return err
+			}
+		}
+		post.Media[i] = attached
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// Mention is an @username in the content of a post or comment that refers to
+// a user. Start and End are offsets in runes into the content; the range
+// includes the @ and End is exclusive.
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+// Entities are the structured parts of the content of a post or comment.
+type Entities struct {
+	Mentions []Mention `json:"mentions"`
+}
+
+type MentionStore struct {
+	db *db.DB
+}
+
+// GetByPostIDs returns the mentions in each of postIDs, in the order they
+// appear. Posts without mentions are left out of the result.
+func (s *MentionStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Mention, error) {
+	return s.getByTargets(ctx, "post_id", postIDs)
+}
+
+// GetByCommentIDs is GetByPostIDs for comments.
+func (s *MentionStore) GetByCommentIDs(ctx context.Context, commentIDs []int64) (map[int64][]Mention, error) {
+	return s.getByTargets(ctx, "comment_id", commentIDs)
+}
+
+func (s *MentionStore) getByTargets(ctx context.Context, column string, ids []int64) (map[int64][]Mention, error) {
+	mentions := make(map[int64][]Mention)
+	if len(ids) == 0 {
+		return mentions, nil
+	}
+
+	// Usernames are joined in so that renamed users show their current name
+	query := `
+	SELECT m.` + column + `, m.user_id, u.username, m.start_offset, m.end_offset
+	FROM mentions m
+	JOIN users u ON u.id = m.user_id
+	WHERE m.` + column + ` = ANY($1)
+	ORDER BY m.` + column + `, m.start_offset`
+
+	rows, err := s.db.Query(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var m Mention
+		if err := rows.Scan(&id, &m.UserID, &m.Username, &m.Start, &m.End); err != nil {
+			return nil, err
+		}
+		mentions[id] = append(mentions[id], m)
+	}
+	return mentions, rows.Err()
+}
+
+// mentionTarget is the post, or the comment on a post, that mentions are
+// saved for.
+type mentionTarget struct {
+	postID    int64
+	commentID *int64
+}
+
+// saveMentions replaces the mentions of target and notifies the users
+// mentioned by actorID who weren't mentioned there before, so that edits
+// don't notify anyone twice. Nobody is notified of mentioning themselves.
+func saveMentions(ctx context.Context, tx *sql.Tx, target mentionTarget, actorID int64, mentions []Mention) error {
+	column, id := "post_id", target.postID
+	if target.commentID != nil {
+		column, id = "comment_id", *target.commentID
+	}
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM mentions WHERE `+column+` = $1 RETURNING user_id`, id)
+	if err != nil {
+		return err
+	}
+	previous := map[int64]bool{}
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return err
+		}
+		previous[userID] = true
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if len(mentions) == 0 {
+		return nil
+	}
+
+	userIDs := make([]int64, len(mentions))
+	starts := make([]int64, len(mentions))
+	ends := make([]int64, len(mentions))
+	var notify []int64
+	for i, m := range mentions {
+		userIDs[i], starts[i], ends[i] = m.UserID, int64(m.Start), int64(m.End)
+		if !previous[m.UserID] && m.UserID != actorID {
+			previous[m.UserID] = true
+			notify = append(notify, m.UserID)
+		}
+	}
+
+	var postID *int64
+	if target.commentID == nil {
+		postID = &target.postID
+	}
+	query := `
+	INSERT INTO mentions (post_id, comment_id, user_id, start_offset, end_offset)
+	SELECT $1, $2, m.user_id, m.start_offset, m.end_offset
+	FROM unnest($3::bigint[], $4::int[], $5::int[]) AS m(user_id, start_offset, end_offset)`
+	if _, err := tx.ExecContext(ctx, query, postID, target.commentID, pq.Array(userIDs), pq.Array(starts), pq.Array(ends)); err != nil {
+		return err
+	}
+
+	if len(notify) == 0 {
+		return nil
+	}
+
+	query = `
+	INSERT INTO notifications (user_id, actor_id, kind, post_id, comment_id)
+	SELECT unnest($1::bigint[]), $2, $3, $4, $5`
+	_, err = tx.ExecContext(ctx, query, pq.Array(notify), actorID, NotificationMention, target.postID, target.commentID)
+	return err
+}
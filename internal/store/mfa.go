@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+var ErrMFAEnabled = errors.New("two-factor authentication is already enabled")
+
+// MFA holds a user's TOTP enrollment. Secret is encrypted by the caller before
+// it is stored.
+type MFA struct {
+	UserID       int64
+	Secret       []byte
+	Enabled      bool
+	LastUsedStep int64
+	CreatedAt    time.Time
+	EnabledAt    *time.Time
+}
+
+type MFAStore struct {
+	db *db.DB
+}
+
+func (s *MFAStore) GetByUserID(ctx context.Context, userID int64) (*MFA, error) {
+	query := `SELECT user_id, secret, enabled, last_used_step, created_at, enabled_at FROM user_mfa WHERE user_id = $1`
+
+	mfa := &MFA{}
+	err := s.db.QueryRow(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep, &mfa.CreatedAt, &mfa.EnabledAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return mfa, nil
+}
+
+// SavePending stores a new, not yet enabled, secret. It replaces an earlier
+// pending enrollment but never an enabled one.
+func (s *MFAStore) SavePending(ctx context.Context, userID int64, secret []byte) error {
+	query := `
+	INSERT INTO user_mfa (user_id, secret) VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+	WHERE user_mfa.enabled = false`
+
+	res, err := s.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrMFAEnabled
+	}
+	return nil
+}
+
+// Enable turns on a pending enrollment and replaces the user's recovery codes.
+func (s *MFAStore) Enable(ctx context.Context, userID int64, step int64, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `
+		UPDATE user_mfa SET enabled = true, enabled_at = now(), last_used_step = $2
+		WHERE user_id = $1 AND enabled = false`
+
+		res, err := tx.ExecContext(ctx, query, userID, step)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	})
+}
+
+func (s *MFAStore) Disable(ctx context.Context, userID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// UseStep records a TOTP time step as used. It returns ErrNotFound if the
+// step, or a later one, was already used so codes can't be replayed.
+func (s *MFAStore) UseStep(ctx context.Context, userID int64, step int64) error {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND enabled = true AND last_used_step < $2`
+	res, err := s.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UseRecoveryCode consumes an unused recovery code.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error {
+	query := `UPDATE mfa_recovery_codes SET used_at = now() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := s.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, hashes [][]byte) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// Notification kinds
+const (
+	NotificationMention = "mention"
+)
+
+// Notification tells a user that Actor did something involving them, such as
+// mentioning them in a post or in a comment on a post.
+type Notification struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"-"`
+	Kind      string     `json:"kind"`
+	Actor     User       `json:"actor"`
+	PostID    int64      `json:"post_id"`
+	CommentID *int64     `json:"comment_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+// NotificationPage is one page of notifications and the cursor of the next
+// page, which is empty on the last page.
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
+
+// notificationVisible holds for the notifications n a user gets to see: those
+// about published posts outside the trash, from users they haven't blocked.
+const notificationVisible = `
+	EXISTS (SELECT 1 FROM posts p WHERE p.id = n.post_id AND p.deleted_at IS NULL AND p.status = 'published')
+	AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = n.user_id AND b.blocked_id = n.actor_id)`
+
+type NotificationStore struct {
+	db *db.DB
+}
+
+// GetByUserID returns a page of a user's notifications, newest first.
+// Notifications about posts that aren't published, or are in the trash, are
+// left out until the post is visible, as are those from users the user has
+// blocked.
+func (s *NotificationStore) GetByUserID(ctx context.Context, userID int64, nq PaginatedNotificationQuery) (*NotificationPage, error) {
+	after, err := decodeCursor(nq.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// One row more than requested tells whether there is a next page
+	query := `
+	SELECT n.id, n.user_id, n.kind, n.actor_id, u.username, n.post_id, n.comment_id, n.created_at, n.read_at
+	FROM notifications n
+	JOIN users u ON u.id = n.actor_id
+	WHERE n.user_id = $1 AND ($2 = 0 OR n.id < $2) AND (NOT $3 OR n.read_at IS NULL) AND` + notificationVisible + `
+	ORDER BY n.id DESC
+	LIMIT $4`
+
+	rows, err := s.db.Query(ctx, query, userID, after, nq.Unread, nq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &NotificationPage{Notifications: []Notification{}}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Actor.ID, &n.Actor.Username, &n.PostID, &n.CommentID, &n.CreatedAt, &n.ReadAt); err != nil {
+			return nil, err
+		}
+		page.Notifications = append(page.Notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Notifications) > nq.Limit {
+		page.Notifications = page.Notifications[:nq.Limit]
+		page.NextCursor = encodeCursor(page.Notifications[nq.Limit-1].ID)
+	}
+	return page, nil
+}
+
+// MarkAllRead marks the unread notifications a user can see as read. Hidden
+// ones stay unread, so they show up as new once their post is visible again.
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) error {
+	query := `
+	UPDATE notifications n SET read_at = now()
+	WHERE n.user_id = $1 AND n.read_at IS NULL AND` + notificationVisible
+	_, err := s.db.Exec(ctx, query, userID)
+	return err
+}
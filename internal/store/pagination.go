@@ -1,11 +1,15 @@
 package store
 
 import (
+	"encoding/base64"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type PaginatedFeedQuery struct {
 	Limit  int      `json:"limit" validate:"gte=1, lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
@@ -70,3 +74,167 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	return fq, nil
 
 }
+
+// PaginatedCommentQuery pages through comments with an opaque cursor, which is
+// more stable than an offset while new comments are being added.
+type PaginatedCommentQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"max=64"`
+	Sort   string `json:"sort" validate:"oneof=asc desc"`
+	// Depth is how many levels of replies are loaded below each comment.
+	Depth int `json:"depth" validate:"gte=0"`
+}
+
+func (cq PaginatedCommentQuery) Parse(r *http.Request) (PaginatedCommentQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq, err
+		}
+		cq.Limit = l
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		cq.Cursor = cursor
+	}
+
+	if sort := qs.Get("sort"); sort != "" {
+		cq.Sort = sort
+	}
+
+	if depth := qs.Get("depth"); depth != "" {
+		d, err := strconv.Atoi(depth)
+		if err != nil {
+			return cq, err
+		}
+		cq.Depth = d
+	}
+
+	return cq, nil
+}
+
+// PaginatedBookmarkQuery pages through a user's bookmarks, newest first.
+type PaginatedBookmarkQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"max=64"`
+	// CollectionID limits the listing to one collection.
+	CollectionID *int64 `json:"collection_id" validate:"omitempty,gt=0"`
+}
+
+func (bq PaginatedBookmarkQuery) Parse(r *http.Request) (PaginatedBookmarkQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return bq, err
+		}
+		bq.Limit = l
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		bq.Cursor = cursor
+	}
+
+	if collection := qs.Get("collection_id"); collection != "" {
+		id, err := strconv.ParseInt(collection, 10, 64)
+		if err != nil {
+			return bq, err
+		}
+		bq.CollectionID = &id
+	}
+
+	return bq, nil
+}
+
+// PaginatedUnpublishedQuery pages through a user's drafts and scheduled posts,
+// newest first.
+type PaginatedUnpublishedQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"max=64"`
+	// Status limits the listing to drafts or to scheduled posts.
+	Status string `json:"status" validate:"omitempty,oneof=draft scheduled"`
+}
+
+func (uq PaginatedUnpublishedQuery) Parse(r *http.Request) (PaginatedUnpublishedQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return uq, err
+		}
+		uq.Limit = l
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		uq.Cursor = cursor
+	}
+
+	if status := qs.Get("status"); status != "" {
+		uq.Status = status
+	}
+
+	return uq, nil
+}
+
+// PaginatedNotificationQuery pages through a user's notifications, newest
+// first.
+type PaginatedNotificationQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"max=64"`
+	// Unread limits the listing to notifications that haven't been read.
+	Unread bool `json:"unread"`
+}
+
+func (nq PaginatedNotificationQuery) Parse(r *http.Request) (PaginatedNotificationQuery, error) {
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return nq, err
+		}
+		nq.Limit = l
+	}
+
+	if cursor := qs.Get("cursor"); cursor != "" {
+		nq.Cursor = cursor
+	}
+
+	if unread := qs.Get("unread"); unread != "" {
+		u, err := strconv.ParseBool(unread)
+		if err != nil {
+			return nq, err
+		}
+		nq.Unread = u
+	}
+
+	return nq, nil
+}
+
+// encodeCursor returns an opaque cursor pointing after the row with the given id.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the id an opaque cursor points after. An empty cursor
+// decodes to zero.
+func decodeCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// PersonalAccessToken is a long-lived, scoped token used by automation.
+// Only a hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	TokenHash  []byte     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope reports whether the token was granted scope.
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PersonalAccessTokenStore struct {
+	db *db.DB
+}
+
+func (s *PersonalAccessTokenStore) Create(ctx context.Context, token *PersonalAccessToken) error {
+	query := `
+	INSERT INTO personal_access_tokens (user_id, name, scopes, token_hash, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+	return s.db.QueryRow(ctx, query, token.UserID, token.Name, pq.Array(token.Scopes), token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (s *PersonalAccessTokenStore) GetByHash(ctx context.Context, hash []byte) (*PersonalAccessToken, error) {
+	query := `
+	SELECT id, user_id, name, scopes, token_hash, expires_at, last_used_at, created_at
+	FROM personal_access_tokens
+	WHERE token_hash = $1`
+
+	token := &PersonalAccessToken{}
+	err := s.db.QueryRow(ctx, query, hash).Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.TokenHash, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+func (s *PersonalAccessTokenStore) GetByUserID(ctx context.Context, userID int64) ([]*PersonalAccessToken, error) {
+	query := `
+	SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+	FROM personal_access_tokens
+	WHERE user_id = $1
+	ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*PersonalAccessToken{}
+	for rows.Next() {
+		token := &PersonalAccessToken{}
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Delete revokes a token owned by the user.
+func (s *PersonalAccessTokenStore) Delete(ctx context.Context, userID int64, tokenID int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+	res, err := s.db.Exec(ctx, query, tokenID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PersonalAccessTokenStore) TouchLastUsed(ctx context.Context, tokenID int64) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = now() WHERE id = $1`
+	_, err := s.db.Exec(ctx, query, tokenID)
+	return err
+}
@@ -4,59 +4,122 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/yusuf-cirak/social/internal/db"
 )
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound     = errors.New("not found")
+	ErrEditConflict = errors.New("edit conflict")
+)
+
+// Post statuses. Only published posts are visible to users other than the
+// author.
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
 )
 
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Version   int       `json:"version"`
+	ID        int64    `json:"id"`
+	Content   string   `json:"content"`
+	Title     string   `json:"title"`
+	UserID    int64    `json:"user_id"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+	Version   int      `json:"version"`
+	Status    string   `json:"status"`
+	// PublishAt is when the post went live, or goes live if it is scheduled.
+	// Drafts have none.
+	PublishAt *time.Time `json:"publish_at"`
+	// QuotedPostID makes the post a quote of another post, which is embedded
+	// as QuotedPost.
+	QuotedPostID *int64       `json:"quoted_post_id,omitempty"`
+	QuotedPost   *PostSummary `json:"quoted_post,omitempty"`
+	// DeletedAt is set while the post is in its owner's trash, and DeletedBy
+	// to the user who moved it there.
+	DeletedAt *string `json:"deleted_at,omitempty"`
+	DeletedBy *int64  `json:"deleted_by,omitempty"`
+	// Media are the files attached to the post, in order.
+	Media     []*Media  `json:"media,omitempty"`
+	Entities  Entities  `json:"entities,omitzero"`
 	Comments  []Comment `json:"comments"`
 	User      User      `json:"user"`
+	Reactions Reactions `json:"reactions,omitzero"`
 }
 
 type PostWithMetadata struct {
 	Post
 	CommentCount int `json:"comment_count"`
+	// RepostedBy names the followed users who reposted the post, when it
+	// appears in a feed because of them.
+	RepostedBy []string `json:"reposted_by,omitempty"`
+	// Tombstone is set for reposts of a post that has since been deleted.
+	// Only the ID of the post is kept.
+	Tombstone bool `json:"tombstone,omitempty"`
 }
 
 type PostStore struct {
 	db *db.DB
 }
 
+// Create stores a post. Posts without a status are published right away.
+// post.Media only needs the IDs of the media to attach; it returns
+// ErrMediaUnavailable if any of them can't be attached. The users in
+// post.Entities.Mentions are notified.
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
-	query := `INSERT INTO posts (content, title, user_id, tags) VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
+	if post.Status == "" {
+		post.Status = PostPublished
+	}
 
-	err := s.db.QueryRow(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags)).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
 
-	return err
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `
+		INSERT INTO posts (content, title, user_id, tags, status, publish_at, quoted_post_id)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 = 'published' THEN now() ELSE $6 END, $7)
+		RETURNING id, created_at, updated_at, version, publish_at`
+
+		err := tx.QueryRowContext(ctx, query, post.Content, post.Title, post.UserID, pq.Array(post.Tags), post.Status, post.PublishAt, post.QuotedPostID).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.PublishAt)
+		if err != nil {
+			return err
+		}
+
+		if err := attachMedia(ctx, tx, post); err != nil {
+			return err
+		}
+
+		return saveMentions(ctx, tx, mentionTarget{postID: post.ID}, post.UserID, post.Entities.Mentions)
+	})
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
-	query := `
-	UPDATE posts
-	SET title = $1, content= $2
-	WHERE id = $3 AND version = $4
-	RETURNING version
-	`
+// Update saves post if it is still at post.Version and bumps the version.
+// The previous title and content are kept as a revision edited by editorID.
+// The mentions are replaced by post.Entities.Mentions, and newly mentioned
+// users are notified. It returns ErrEditConflict if the post was changed in
+// the meantime. A published post is never taken back to a draft or
+// scheduled; a post.Status asking for that also returns ErrEditConflict, as
+// it can only come from a stale copy of the post.
+func (s *PostStore) Update(ctx context.Context, post *Post, editorID int64) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
 
-	err := s.db.QueryRow(ctx, query, post.Title, post.Content, post.ID, post.Version).Scan(&post.Version)
+	err := s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		if err := updatePost(ctx, tx, post, editorID); err != nil {
+			return err
+		}
+		return saveMentions(ctx, tx, mentionTarget{postID: post.ID}, post.UserID, post.Entities.Mentions)
+	})
 
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
+			return s.updateMissError(ctx, post.ID)
 		default:
 			return err
 		}
@@ -64,11 +127,50 @@ func (s *PostStore) Update(ctx context.Context, post *Post) error {
 	return nil
 }
 
+func updatePost(ctx context.Context, tx *sql.Tx, post *Post, editorID int64) error {
+	query := `
+	WITH old AS (
+		SELECT id, version, title, content FROM posts
+		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+			AND (status <> 'published' OR $6 = 'published')
+		FOR UPDATE
+	), revision AS (
+		INSERT INTO post_revisions (post_id, version, title, content, editor_id)
+		SELECT id, version, title, content, $5 FROM old
+	)
+	UPDATE posts
+	SET title = $1, content= $2, version = posts.version + 1, updated_at = now(),
+		status = $6, publish_at = CASE WHEN $6 = 'published' AND posts.status <> 'published' THEN now() ELSE $7 END
+	FROM old
+	WHERE posts.id = old.id
+	RETURNING posts.version, posts.updated_at, posts.publish_at
+	`
+
+	return tx.QueryRowContext(ctx, query, post.Title, post.Content, post.ID, post.Version, editorID, post.Status, post.PublishAt).Scan(&post.Version, &post.UpdatedAt, &post.PublishAt)
+}
+
+// updateMissError tells a deleted post from one whose version moved on.
+func (s *PostStore) updateMissError(ctx context.Context, id int64) error {
+	var exists bool
+	if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return ErrEditConflict
+}
+
 func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
-	query := `SELECT id, content, title, user_id, tags, created_at, updated_at, version FROM posts WHERE id = $1`
+	query := `
+	SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, p.version, p.status, p.publish_at, p.quoted_post_id, ` + quoteColumns + `
+	FROM posts p` + quoteJoins + `
+	WHERE p.id = $1 AND p.deleted_at IS NULL`
 
 	post := &Post{}
-	err := s.db.QueryRow(ctx, query, id).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version)
+	var quote quoteRow
+	dest := append([]any{&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt, &post.QuotedPostID}, quote.dest()...)
+	err := s.db.QueryRow(ctx, query, id).Scan(dest...)
 
 	if err != nil {
 		switch {
@@ -78,12 +180,15 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 			return nil, err
 		}
 	}
+	post.QuotedPost = quote.summary(post.QuotedPostID)
 	return post, nil
 }
 
-func (s *PostStore) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM posts WHERE id = $1`
-	res, err := s.db.Exec(ctx, query, id)
+// Delete moves a post to its owner's trash on behalf of deletedBy. The post
+// and its comments are kept until PurgeDeleted removes them.
+func (s *PostStore) Delete(ctx context.Context, id, deletedBy int64) error {
+	query := `UPDATE posts SET deleted_at = now(), deleted_by = $2 WHERE id = $1 AND deleted_at IS NULL`
+	res, err := s.db.Exec(ctx, query, id, deletedBy)
 
 	if err != nil {
 		return err
@@ -100,24 +205,231 @@ func (s *PostStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// PostPage is one page of posts and the cursor of the next page, which is
+// empty on the last page.
+type PostPage struct {
+	Posts      []*Post `json:"posts"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// GetUnpublished returns a page of a user's drafts and scheduled posts, which
+// no other listing includes.
+func (s *PostStore) GetUnpublished(ctx context.Context, userID int64, uq PaginatedUnpublishedQuery) (*PostPage, error) {
+	after, err := decodeCursor(uq.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	// One row more than requested tells whether there is a next page
+	query := `
+	SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, p.version, p.status, p.publish_at, p.quoted_post_id, ` + quoteColumns + `
+	FROM posts p` + quoteJoins + `
+	WHERE p.user_id = $1 AND p.deleted_at IS NULL AND p.status <> 'published'
+		AND ($2::text = '' OR p.status = $2) AND ($3 = 0 OR p.id < $3)
+	ORDER BY p.id DESC
+	LIMIT $4`
+
+	rows, err := s.db.Query(ctx, query, userID, uq.Status, after, uq.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &PostPage{Posts: []*Post{}}
+	for rows.Next() {
+		post := &Post{}
+		var quote quoteRow
+		dest := append([]any{&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt, &post.QuotedPostID}, quote.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		post.QuotedPost = quote.summary(post.QuotedPostID)
+		page.Posts = append(page.Posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Posts) > uq.Limit {
+		page.Posts = page.Posts[:uq.Limit]
+		page.NextCursor = encodeCursor(page.Posts[uq.Limit-1].ID)
+	}
+	return page, nil
+}
+
+// GetTrash lists a user's posts deleted within retention, most recently
+// deleted first.
+func (s *PostStore) GetTrash(ctx context.Context, userID int64, retention time.Duration) ([]*Post, error) {
+	query := `
+	SELECT id, content, title, user_id, tags, created_at, updated_at, version, status, publish_at, deleted_at, deleted_by
+	FROM posts
+	WHERE user_id = $1 AND deleted_at > now() - $2 * interval '1 second'
+	ORDER BY deleted_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID, int64(retention.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*Post{}
+	for rows.Next() {
+		post := &Post{}
+		if err := rows.Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt, &post.DeletedAt, &post.DeletedBy); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// GetDeleted returns a post that was deleted within retention. Posts that
+// aren't in the trash, or have been there longer, are reported as ErrNotFound.
+func (s *PostStore) GetDeleted(ctx context.Context, id int64, retention time.Duration) (*Post, error) {
+	query := `
+	SELECT id, content, title, user_id, tags, created_at, updated_at, version, status, publish_at, deleted_at, deleted_by
+	FROM posts
+	WHERE id = $1 AND deleted_at > now() - $2 * interval '1 second'`
+
+	post := &Post{}
+	err := s.db.QueryRow(ctx, query, id, int64(retention.Seconds())).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt, &post.DeletedAt, &post.DeletedBy)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return post, nil
+}
+
+// Restore takes a post out of the trash. Posts deleted longer than retention
+// ago can't be restored and are reported as ErrNotFound.
+func (s *PostStore) Restore(ctx context.Context, id int64, retention time.Duration) (*Post, error) {
+	query := `
+	UPDATE posts SET deleted_at = NULL, deleted_by = NULL
+	WHERE id = $1 AND deleted_at > now() - $2 * interval '1 second'
+	RETURNING id, content, title, user_id, tags, created_at, updated_at, version, status, publish_at`
+
+	post := &Post{}
+	err := s.db.QueryRow(ctx, query, id, int64(retention.Seconds())).Scan(&post.ID, &post.Content, &post.Title, &post.UserID, pq.Array(&post.Tags), &post.CreatedAt, &post.UpdatedAt, &post.Version, &post.Status, &post.PublishAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return post, nil
+}
+
+// PublishDue publishes up to limit scheduled posts whose time has come and
+// returns how many it published. Rows locked by a concurrent call are
+// skipped, so several replicas can run it at once without blocking each
+// other or publishing a post twice. Publishing bumps the version, so edits
+// based on the scheduled post fail with ErrEditConflict.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) (int, error) {
+	query := `
+	WITH due AS (
+		SELECT id FROM posts
+		WHERE status = 'scheduled' AND publish_at <= now() AND deleted_at IS NULL
+		ORDER BY publish_at
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	UPDATE posts SET status = 'published', version = version + 1, updated_at = now()
+	FROM due
+	WHERE posts.id = due.id`
+
+	res, err := s.db.Exec(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// PurgeDeleted removes posts deleted longer than retention ago, along with
+// their comments.
+func (s *PostStore) PurgeDeleted(ctx context.Context, retention time.Duration) error {
+	query := `DELETE FROM posts WHERE deleted_at <= now() - $1 * interval '1 second'`
+	_, err := s.db.Exec(ctx, query, int64(retention.Seconds()))
+	return err
+}
+
+// GetUserFeed returns the posts of the users userID follows and of userID,
+// together with the posts they reposted. A post shows up once, however many
+// followed users reposted it: at its most recent activity when sorted newest
+// first, and at its earliest when sorted oldest first.
 func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	// A post is placed by whichever of its activities comes first in the sort
+	// order. Each author's posts and reposts can then be read in that order
+	// from an index and cut off at the end of the requested page: activity
+	// further down one author's list belongs to a post that can't be on it.
+	// Reposters are looked up for the page's posts only, as the cut-off
+	// activity may include some of theirs.
+	at := "max"
+	if fq.Sort == "asc" {
+		at = "min"
+	}
+
+	// case insensitive search and array contains check
+	matches := `(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND (p.tags @> $5 OR $5 = '{}')`
+
 	query := `
-	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags, u.username, COUNT(c.id) as comments_count
-	FROM posts p
-	LEFT JOIN comments c ON c.post_id = p.id
-	LEFT JOIN users u ON p.user_id = u.id
-	JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-
-	WHERE f.user_id = $1 AND
-	(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND # case insensitive search
-	(p.tags @> $5 OR $5 = '{}') # array contains check
-
-	GROUP BY p.id, u.username
-	ORDER BY p.created_at ` + fq.Sort + `
+	WITH authors AS (
+		SELECT user_id FROM followers WHERE follower_id = $1
+		UNION SELECT $1
+	), activity AS (
+		SELECT a.post_id, a.at
+		FROM authors au
+		CROSS JOIN LATERAL (
+			SELECT p.id AS post_id, p.publish_at AS at
+			FROM posts p
+			WHERE p.user_id = au.user_id AND p.status = 'published' AND p.deleted_at IS NULL AND ` + matches + `
+			ORDER BY p.publish_at ` + fq.Sort + `
+			LIMIT $6
+		) a
+		UNION ALL
+		SELECT a.post_id, a.at
+		FROM authors au
+		CROSS JOIN LATERAL (
+			SELECT r.post_id, r.created_at AS at
+			FROM reposts r
+			JOIN posts p ON p.id = r.post_id AND p.status = 'published'
+			WHERE r.user_id = au.user_id AND (
+				(p.deleted_at IS NULL AND ` + matches + `)
+				-- reposts of deleted posts stay as tombstones in an unfiltered feed
+				OR (p.deleted_at IS NOT NULL AND $4 = '' AND $5 = '{}')
+			)
+			ORDER BY r.created_at ` + fq.Sort + `
+			LIMIT $6
+		) a
+	), feed AS (
+		SELECT post_id, ` + at + `(at) AS at
+		FROM activity
+		GROUP BY post_id
+	)
+	SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.status, p.publish_at, p.tags, u.username,
+		(SELECT count(*) FROM comments c WHERE c.post_id = p.id),
+		ARRAY(
+			SELECT ru.username FROM reposts r JOIN users ru ON ru.id = r.user_id
+			WHERE r.post_id = p.id AND r.user_id IN (SELECT user_id FROM authors)
+			ORDER BY ru.username
+		),
+		p.deleted_at IS NOT NULL,
+		p.quoted_post_id, ` + quoteColumns + `
+	FROM feed
+	JOIN posts p ON p.id = feed.post_id
+	JOIN users u ON p.user_id = u.id` + quoteJoins + `
+	ORDER BY feed.at ` + fq.Sort + `, p.id ` + fq.Sort + `
 	LIMIT $2 OFFSET $3
 	`
 
-	rows, err := s.db.Query(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := s.db.Query(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags), fq.Offset+fq.Limit)
 	if err != nil {
 		return nil, err
 	}
@@ -127,10 +439,19 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 	var posts []*PostWithMetadata
 	for rows.Next() {
 		post := &PostWithMetadata{}
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.Version, pq.Array(&post.Tags), &post.User.Username, &post.CommentCount); err != nil {
+		var quote quoteRow
+		dest := append([]any{&post.ID, &post.UserID, &post.Title, &post.Content, &post.CreatedAt, &post.Version, &post.Status, &post.PublishAt, pq.Array(&post.Tags), &post.User.Username,
+			&post.CommentCount, pq.Array(&post.RepostedBy), &post.Tombstone, &post.QuotedPostID}, quote.dest()...)
+		if err := rows.Scan(dest...); err != nil {
 			return nil, err
 		}
+
+		if post.Tombstone {
+			*post = PostWithMetadata{Post: Post{ID: post.ID}, RepostedBy: post.RepostedBy, Tombstone: true}
+		} else {
+			post.QuotedPost = quote.summary(post.QuotedPostID)
+		}
 		posts = append(posts, post)
 	}
-	return posts, nil
+	return posts, rows.Err()
 }
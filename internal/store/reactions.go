@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// Reaction target types
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// ReactionKinds lists the reactions users can leave.
+var ReactionKinds = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+type Reaction struct {
+	UserID     int64
+	TargetType string
+	TargetID   int64
+	Kind       string
+}
+
+// Reactions summarizes the reactions on a post or comment.
+type Reactions struct {
+	// Counts maps each kind to how many users reacted with it.
+	Counts map[string]int `json:"counts"`
+	// Mine lists the kinds the current user reacted with. It is empty for
+	// anonymous requests.
+	Mine []string `json:"mine"`
+}
+
+func newReactions() Reactions {
+	return Reactions{Counts: map[string]int{}, Mine: []string{}}
+}
+
+type ReactionStore struct {
+	db *db.DB
+}
+
+// Add stores a reaction. Adding one that already exists does nothing.
+func (s *ReactionStore) Add(ctx context.Context, r *Reaction) error {
+	query := `
+	INSERT INTO reactions (user_id, target_type, target_id, kind)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT DO NOTHING`
+
+	_, err := s.db.Exec(ctx, query, r.UserID, r.TargetType, r.TargetID, r.Kind)
+	return err
+}
+
+// Remove deletes a reaction. Removing one that doesn't exist does nothing.
+func (s *ReactionStore) Remove(ctx context.Context, r *Reaction) error {
+	query := `
+	DELETE FROM reactions
+	WHERE user_id = $1 AND target_type = $2 AND target_id = $3 AND kind = $4`
+
+	_, err := s.db.Exec(ctx, query, r.UserID, r.TargetType, r.TargetID, r.Kind)
+	return err
+}
+
+// Summarize returns the reactions on each of targetIDs as seen by userID,
+// which is 0 for anonymous requests. Every target is in the result, with
+// empty counts if nobody reacted to it.
+func (s *ReactionStore) Summarize(ctx context.Context, targetType string, targetIDs []int64, userID int64) (map[int64]Reactions, error) {
+	summaries := make(map[int64]Reactions, len(targetIDs))
+	for _, id := range targetIDs {
+		summaries[id] = newReactions()
+	}
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	query := `
+	SELECT target_id, kind, count(*), bool_or(user_id = $3)
+	FROM reactions
+	WHERE target_type = $1 AND target_id = ANY($2)
+	GROUP BY target_id, kind
+	ORDER BY target_id, kind`
+
+	rows, err := s.db.Query(ctx, query, targetType, pq.Array(targetIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id    int64
+			kind  string
+			count int
+			mine  bool
+		)
+		if err := rows.Scan(&id, &kind, &count, &mine); err != nil {
+			return nil, err
+		}
+
+		summary := summaries[id]
+		summary.Counts[kind] = count
+		if mine {
+			summary.Mine = append(summary.Mine, kind)
+		}
+		summaries[id] = summary
+	}
+	return summaries, rows.Err()
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// RefreshToken is a server-side record of an issued refresh token. Tokens that
+// are rotated from one another share a FamilyID.
+type RefreshToken struct {
+	ID        int64
+	UserID    int64
+	TokenHash []byte
+	FamilyID  string
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type RefreshTokenStore struct {
+	db *db.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	query := `
+	INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at`
+
+	return s.db.QueryRow(ctx, query, token.UserID, token.TokenHash, token.FamilyID, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (s *RefreshTokenStore) GetByHash(ctx context.Context, hash []byte) (*RefreshToken, error) {
+	query := `
+	SELECT id, user_id, token_hash, family_id, expires_at, revoked_at, created_at
+	FROM refresh_tokens
+	WHERE token_hash = $1`
+
+	token := &RefreshToken{}
+	err := s.db.QueryRow(ctx, query, hash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.FamilyID, &token.ExpiresAt, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// Rotate revokes current and stores next in a single transaction. It returns
+// ErrNotFound if current was already revoked, which means it has been reused.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, current *RefreshToken, next *RefreshToken) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, current.ID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+		return tx.QueryRowContext(ctx, query, next.UserID, next.TokenHash, next.FamilyID, next.ExpiresAt).Scan(&next.ID, &next.CreatedAt)
+	})
+}
+
+// RevokeFamily revokes every token rotated from the same login and ends the
+// login's session.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`
+		if _, err := tx.ExecContext(ctx, query, familyID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, familyID)
+		return err
+	})
+}
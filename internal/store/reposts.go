@@ -0,0 +1,107 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// summaryExcerptLength is how many characters of a quoted post's content are
+// embedded in the quote.
+const summaryExcerptLength = 140
+
+// PostSummary is the part of a post embedded in the posts that quote it. A
+// post that was deleted or can't be seen is reduced to a tombstone with only
+// its ID.
+type PostSummary struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title,omitempty"`
+	Excerpt   string `json:"excerpt,omitempty"`
+	UserID    int64  `json:"user_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	CreatedAt string `json:"created_at,omitempty"`
+	Tombstone bool   `json:"tombstone,omitempty"`
+}
+
+// Summary returns the summary embedded in posts quoting p.
+func (p *Post) Summary() *PostSummary {
+	excerpt := []rune(p.Content)
+	if len(excerpt) > summaryExcerptLength {
+		excerpt = append(excerpt[:summaryExcerptLength-1], '…')
+	}
+
+	return &PostSummary{
+		ID:        p.ID,
+		Title:     p.Title,
+		Excerpt:   string(excerpt),
+		UserID:    p.UserID,
+		Username:  p.User.Username,
+		CreatedAt: p.CreatedAt,
+	}
+}
+
+// quoteColumns and quoteJoins load the post quoted by the post aliased p.
+// Only published posts that aren't deleted are joined.
+const (
+	quoteColumns = `q.id, q.title, q.content, q.user_id, qu.username, q.created_at`
+	quoteJoins   = `
+	LEFT JOIN posts q ON q.id = p.quoted_post_id AND q.deleted_at IS NULL AND q.status = 'published'
+	LEFT JOIN users qu ON qu.id = q.user_id`
+)
+
+// quoteRow scans quoteColumns.
+type quoteRow struct {
+	id        sql.NullInt64
+	title     sql.NullString
+	content   sql.NullString
+	userID    sql.NullInt64
+	username  sql.NullString
+	createdAt sql.NullString
+}
+
+func (q *quoteRow) dest() []any {
+	return []any{&q.id, &q.title, &q.content, &q.userID, &q.username, &q.createdAt}
+}
+
+// summary returns the summary of the quoted post, a tombstone if it is gone,
+// or nil if the post doesn't quote anything.
+func (q *quoteRow) summary(quotedPostID *int64) *PostSummary {
+	if quotedPostID == nil {
+		return nil
+	}
+	if !q.id.Valid {
+		return &PostSummary{ID: *quotedPostID, Tombstone: true}
+	}
+
+	quoted := &Post{
+		ID:        q.id.Int64,
+		Title:     q.title.String,
+		Content:   q.content.String,
+		UserID:    q.userID.Int64,
+		CreatedAt: q.createdAt.String,
+		User:      User{ID: q.userID.Int64, Username: q.username.String},
+	}
+	return quoted.Summary()
+}
+
+type RepostStore struct {
+	db *db.DB
+}
+
+// Add reposts a post for userID. Reposting a post again does nothing.
+func (s *RepostStore) Add(ctx context.Context, userID, postID int64) error {
+	query := `
+	INSERT INTO reposts (user_id, post_id)
+	VALUES ($1, $2)
+	ON CONFLICT DO NOTHING`
+
+	_, err := s.db.Exec(ctx, query, userID, postID)
+	return err
+}
+
+// Remove undoes a repost. Removing one that doesn't exist does nothing.
+func (s *RepostStore) Remove(ctx context.Context, userID, postID int64) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM reposts WHERE user_id = $1 AND post_id = $2`, userID, postID)
+	return err
+}
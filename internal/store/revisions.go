@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// PostRevision is a post as it was at Version. It is saved when the post is
+// edited; EditorID is the user who made that edit and EditedAt when.
+type PostRevision struct {
+	ID       int64     `json:"id"`
+	PostID   int64     `json:"post_id"`
+	Version  int       `json:"version"`
+	Title    string    `json:"title"`
+	Content  string    `json:"content"`
+	EditorID *int64    `json:"editor_id"`
+	Editor   *User     `json:"editor,omitempty"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+type PostRevisionStore struct {
+	db *db.DB
+}
+
+// GetByPostID lists the earlier versions of a post, newest first.
+func (s *PostRevisionStore) GetByPostID(ctx context.Context, postID int64) ([]*PostRevision, error) {
+	query := `
+	SELECT r.id, r.post_id, r.version, r.title, r.content, r.editor_id, r.edited_at, u.username
+	FROM post_revisions r
+	LEFT JOIN users u ON r.editor_id = u.id
+	WHERE r.post_id = $1
+	ORDER BY r.version DESC`
+
+	rows, err := s.db.Query(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*PostRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *PostRevisionStore) GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error) {
+	query := `
+	SELECT r.id, r.post_id, r.version, r.title, r.content, r.editor_id, r.edited_at, u.username
+	FROM post_revisions r
+	LEFT JOIN users u ON r.editor_id = u.id
+	WHERE r.post_id = $1 AND r.version = $2`
+
+	revision, err := scanRevision(s.db.QueryRow(ctx, query, postID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return revision, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRevision(row rowScanner) (*PostRevision, error) {
+	revision := &PostRevision{}
+	var editor sql.NullString
+	if err := row.Scan(&revision.ID, &revision.PostID, &revision.Version, &revision.Title, &revision.Content, &revision.EditorID, &revision.EditedAt, &editor); err != nil {
+		return nil, err
+	}
+	if revision.EditorID != nil {
+		revision.Editor = &User{ID: *revision.EditorID, Username: editor.String}
+	}
+	return revision, nil
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// RevokedTokenStore is a Postgres-backed revocation list for access tokens.
+type RevokedTokenStore struct {
+	db *db.DB
+}
+
+func (s *RevokedTokenStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO revoked_tokens (jti, expires_at)
+	VALUES ($1, $2)
+	ON CONFLICT (jti) DO NOTHING`
+	_, err := s.db.Exec(ctx, query, jti, expiresAt)
+	return err
+}
+
+func (s *RevokedTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1 AND expires_at > now())`
+
+	var revoked bool
+	err := s.db.QueryRow(ctx, query, jti).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *RevokedTokenStore) PurgeExpired(ctx context.Context) error {
+	query := `DELETE FROM revoked_tokens WHERE expires_at <= now()`
+	_, err := s.db.Exec(ctx, query)
+	return err
+}
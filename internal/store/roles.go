@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// DefaultRole is assigned to every new account.
+const DefaultRole = "user"
+
+type RoleStore struct {
+	db *db.DB
+}
+
+// GetByUserID returns the names of the roles assigned to a user.
+func (s *RoleStore) GetByUserID(ctx context.Context, userID int64) ([]string, error) {
+	query := `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// Assign grants a role to a user. Assigning a role twice is a no-op.
+func (s *RoleStore) Assign(ctx context.Context, userID int64, role string) error {
+	query := `
+	INSERT INTO user_roles (user_id, role)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id, role) DO NOTHING`
+
+	_, err := s.db.Exec(ctx, query, userID, role)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			switch pqErr.Constraint {
+			case "user_roles_role_fkey":
+				return ErrUnknownRole
+			case "user_roles_user_id_fkey":
+				return ErrNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *RoleStore) Revoke(ctx context.Context, userID int64, role string) error {
+	query := `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`
+	res, err := s.db.Exec(ctx, query, userID, role)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/yusuf-cirak/social/internal/db"
+)
+
+// Session is a login on one device. Its ID is the family ID of the refresh
+// tokens issued for the login and the sid claim of its access tokens.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+type SessionStore struct {
+	db *db.DB
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *Session) error {
+	query := `
+	INSERT INTO sessions (id, user_id, user_agent, ip)
+	VALUES ($1, $2, $3, $4)
+	RETURNING created_at, last_seen_at`
+
+	return s.db.QueryRow(ctx, query, session.ID, session.UserID, session.UserAgent, session.IP).Scan(&session.CreatedAt, &session.LastSeenAt)
+}
+
+func (s *SessionStore) GetByID(ctx context.Context, id string) (*Session, error) {
+	query := `
+	SELECT id, user_id, user_agent, ip, created_at, last_seen_at, revoked_at
+	FROM sessions
+	WHERE id = $1`
+
+	session := &Session{}
+	err := s.db.QueryRow(ctx, query, id).Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// GetActiveByUserID lists the sessions that still hold a usable refresh
+// token, most recently used first.
+func (s *SessionStore) GetActiveByUserID(ctx context.Context, userID int64) ([]*Session, error) {
+	query := `
+	SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.revoked_at
+	FROM sessions s
+	WHERE s.user_id = $1 AND s.revoked_at IS NULL
+	AND EXISTS (
+		SELECT 1 FROM refresh_tokens rt
+		WHERE rt.family_id = s.id AND rt.revoked_at IS NULL AND rt.expires_at > now()
+	)
+	ORDER BY s.last_seen_at DESC`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		session := &Session{}
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch updates the last-seen time and client IP of a session.
+func (s *SessionStore) Touch(ctx context.Context, id string, ip string) error {
+	query := `UPDATE sessions SET last_seen_at = now(), ip = $2 WHERE id = $1 AND revoked_at IS NULL`
+	_, err := s.db.Exec(ctx, query, id, ip)
+	return err
+}
+
+// Revoke terminates one of the user's sessions together with its refresh
+// tokens. It returns ErrNotFound if the user has no such active session.
+func (s *SessionStore) Revoke(ctx context.Context, userID int64, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `UPDATE sessions SET revoked_at = now() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+		res, err := tx.ExecContext(ctx, query, id, userID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`, id)
+		return err
+	})
+}
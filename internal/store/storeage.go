@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"time"
 
+	"github.com/yusuf-cirak/social/internal/audit"
 	"github.com/yusuf-cirak/social/internal/db"
 )
 
@@ -11,30 +13,170 @@ type Storage struct {
 		Create(context.Context, *Post) error
 		GetByID(context.Context, int64) (*Post, error)
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
-		Update(context.Context, *Post) error
-		Delete(context.Context, int64) error
+		GetUnpublished(context.Context, int64, PaginatedUnpublishedQuery) (*PostPage, error)
+		Update(ctx context.Context, post *Post, editorID int64) error
+		Delete(ctx context.Context, id, deletedBy int64) error
+		GetTrash(ctx context.Context, userID int64, retention time.Duration) ([]*Post, error)
+		GetDeleted(ctx context.Context, id int64, retention time.Duration) (*Post, error)
+		Restore(ctx context.Context, id int64, retention time.Duration) (*Post, error)
+		PublishDue(ctx context.Context, limit int) (int, error)
+		PurgeDeleted(ctx context.Context, retention time.Duration) error
 	}
 	Users interface {
 		GetByID(context.Context, int64) (*User, error)
 		Create(context.Context, *User) error
 		GetByEmail(context.Context, string) (*User, error)
+		CreateAndInvite(ctx context.Context, user *User, tokenHash []byte, invitationExp time.Duration) error
+		Activate(ctx context.Context, tokenHash []byte) error
+		Delete(context.Context, int64) error
+		CreatePasswordReset(ctx context.Context, userID int64, tokenHash []byte, exp time.Duration) error
+		ResetPassword(ctx context.Context, tokenHash []byte, user *User) error
+		UpdatePassword(context.Context, *User) error
+		GetMentionable(ctx context.Context, authorID int64, usernames []string) ([]*User, error)
+	}
+	PostRevisions interface {
+		GetByPostID(context.Context, int64) ([]*PostRevision, error)
+		GetByVersion(ctx context.Context, postID int64, version int) (*PostRevision, error)
 	}
 	Comments interface {
 		Create(context.Context, *Comment) error
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		GetByPostID(context.Context, int64, PaginatedCommentQuery) (*CommentPage, error)
+		GetReplies(context.Context, int64, PaginatedCommentQuery) (*CommentPage, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+	}
+	Reactions interface {
+		Add(context.Context, *Reaction) error
+		Remove(context.Context, *Reaction) error
+		Summarize(ctx context.Context, targetType string, targetIDs []int64, userID int64) (map[int64]Reactions, error)
+	}
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByID(context.Context, int64) (*Media, error)
+		GetByPostIDs(context.Context, []int64) (map[int64][]*Media, error)
+		PurgeOrphans(ctx context.Context, olderThan time.Duration, limit int) ([]*Media, error)
+	}
+	Reposts interface {
+		Add(ctx context.Context, userID, postID int64) error
+		Remove(ctx context.Context, userID, postID int64) error
+	}
+	Bookmarks interface {
+		Save(context.Context, *Bookmark) error
+		GetByID(context.Context, int64) (*Bookmark, error)
+		GetByUserID(context.Context, int64, PaginatedBookmarkQuery) (*BookmarkPage, error)
+		Move(context.Context, *Bookmark) error
+		Delete(context.Context, int64) error
+	}
+	BookmarkCollections interface {
+		Create(context.Context, *BookmarkCollection) error
+		GetByID(context.Context, int64) (*BookmarkCollection, error)
+		GetByUserID(context.Context, int64) ([]*BookmarkCollection, error)
+		Rename(context.Context, *BookmarkCollection) error
 		Delete(context.Context, int64) error
 	}
+	Mentions interface {
+		GetByPostIDs(context.Context, []int64) (map[int64][]Mention, error)
+		GetByCommentIDs(context.Context, []int64) (map[int64][]Mention, error)
+	}
+	Notifications interface {
+		GetByUserID(context.Context, int64, PaginatedNotificationQuery) (*NotificationPage, error)
+		MarkAllRead(context.Context, int64) error
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerID, blockedID int64) error
+		Unblock(ctx context.Context, blockerID, blockedID int64) error
+		GetByUserID(context.Context, int64) ([]*Block, error)
+	}
 	Followers interface {
 		Follow(ctx context.Context, followerID int64, userID int64) error
 		Unfollow(ctx context.Context, followerID int64, userID int64) error
 	}
+	RefreshTokens interface {
+		Create(context.Context, *RefreshToken) error
+		GetByHash(context.Context, []byte) (*RefreshToken, error)
+		Rotate(ctx context.Context, current *RefreshToken, next *RefreshToken) error
+		RevokeFamily(ctx context.Context, familyID string) error
+	}
+	Sessions interface {
+		Create(context.Context, *Session) error
+		GetByID(context.Context, string) (*Session, error)
+		GetActiveByUserID(context.Context, int64) ([]*Session, error)
+		Touch(ctx context.Context, id string, ip string) error
+		Revoke(ctx context.Context, userID int64, id string) error
+	}
+	Roles interface {
+		GetByUserID(context.Context, int64) ([]string, error)
+		Assign(ctx context.Context, userID int64, role string) error
+		Revoke(ctx context.Context, userID int64, role string) error
+	}
+	PersonalAccessTokens interface {
+		Create(context.Context, *PersonalAccessToken) error
+		GetByHash(context.Context, []byte) (*PersonalAccessToken, error)
+		GetByUserID(context.Context, int64) ([]*PersonalAccessToken, error)
+		Delete(ctx context.Context, userID int64, tokenID int64) error
+		TouchLastUsed(context.Context, int64) error
+	}
+	MFA interface {
+		GetByUserID(context.Context, int64) (*MFA, error)
+		SavePending(ctx context.Context, userID int64, secret []byte) error
+		Enable(ctx context.Context, userID int64, step int64, recoveryCodeHashes [][]byte) error
+		Disable(context.Context, int64) error
+		UseStep(ctx context.Context, userID int64, step int64) error
+		UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) error
+	}
+	Identities interface {
+		GetUserID(ctx context.Context, provider, subject string) (int64, error)
+		Link(context.Context, *Identity) error
+		CreateUser(context.Context, *User, *Identity) error
+		SaveLoginState(context.Context, *OIDCLoginState) error
+		ConsumeLoginState(ctx context.Context, provider string, stateHash []byte) (*OIDCLoginState, error)
+		PurgeExpiredLoginStates(context.Context) error
+	}
+	LoginFailures interface {
+		LockedUntil(ctx context.Context, keys []string) (time.Time, error)
+		RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+		Lock(ctx context.Context, key string, until time.Time) error
+		Reset(ctx context.Context, key string) error
+		PurgeStale(ctx context.Context, olderThan time.Duration) error
+	}
+	SecurityEvents interface {
+		Create(context.Context, *SecurityEvent) error
+	}
+	AuditLog interface {
+		Record(context.Context, audit.Entry) error
+	}
+	RevokedTokens interface {
+		Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+		IsRevoked(ctx context.Context, jti string) (bool, error)
+		PurgeExpired(context.Context) error
+	}
 }
 
 func NewStorage(db *db.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db: db},
-		Users:     &UserStore{db: db},
-		Comments:  &CommentStore{db: db},
-		Followers: &FollowerStore{db: db},
+		Posts:                &PostStore{db: db},
+		Users:                &UserStore{db: db},
+		PostRevisions:        &PostRevisionStore{db: db},
+		Comments:             &CommentStore{db: db},
+		Reactions:            &ReactionStore{db: db},
+		Media:                &MediaStore{db: db},
+		Reposts:              &RepostStore{db: db},
+		Bookmarks:            &BookmarkStore{db: db},
+		BookmarkCollections:  &BookmarkCollectionStore{db: db},
+		Mentions:             &MentionStore{db: db},
+		Notifications:        &NotificationStore{db: db},
+		Blocks:               &BlockStore{db: db},
+		Followers:            &FollowerStore{db: db},
+		RefreshTokens:        &RefreshTokenStore{db: db},
+		Sessions:             &SessionStore{db: db},
+		RevokedTokens:        &RevokedTokenStore{db: db},
+		Roles:                &RoleStore{db: db},
+		AuditLog:             &AuditLogStore{db: db},
+		MFA:                  &MFAStore{db: db},
+		Identities:           &IdentityStore{db: db},
+		LoginFailures:        &LoginFailureStore{db: db},
+		SecurityEvents:       &SecurityEventStore{db: db},
+		PersonalAccessTokens: &PersonalAccessTokenStore{db: db},
 	}
 }
@@ -2,43 +2,286 @@ package store
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/yusuf-cirak/social/internal/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrDuplicateEmail    = errors.New("a user with that email already exists")
+	ErrDuplicateUsername = errors.New("a user with that username already exists")
 )
 
 type User struct {
-	ID        int64  `json:"id"`
-	Username  string `json:"username"`
-	Email     string `json:"email"`
-	Password  string `json:"-"`
-	CreatedAt string `json:"created_at"`
+	ID        int64    `json:"id"`
+	Username  string   `json:"username"`
+	Email     string   `json:"email"`
+	Password  password `json:"-"`
+	CreatedAt string   `json:"created_at"`
+	IsActive  bool     `json:"is_active"`
+	// PasswordChangedAt is set whenever the password changes; tokens issued
+	// before it are no longer accepted.
+	PasswordChangedAt *time.Time `json:"-"`
+}
+
+// password holds a bcrypt hash of the user's password. The plaintext is only
+// kept around until the user is persisted.
+type password struct {
+	text *string
+	hash []byte
+}
+
+// Set hashes the plaintext password with bcrypt.
+func (p *password) Set(text string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(text), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	p.text = &text
+	p.hash = hash
+
+	return nil
+}
+
+// Compare reports whether the plaintext matches the stored hash.
+func (p *password) Compare(text string) error {
+	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
 }
+
 type UserStore struct {
 	db *db.DB
 }
 
+// Create stores a user with the default role.
 func (s *UserStore) Create(ctx context.Context, user *User) error {
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at`
-	err := s.db.QueryRow(ctx, query, user.Username, user.Email, user.Password).Scan(&user.ID, &user.CreatedAt)
-	return err
+	query := `
+	WITH u AS (
+		INSERT INTO users (username, email, password, is_active) VALUES ($1, $2, $3, $4) RETURNING id, created_at
+	), r AS (
+		INSERT INTO user_roles (user_id, role) SELECT id, $5 FROM u
+	)
+	SELECT id, created_at FROM u`
+	err := s.db.QueryRow(ctx, query, user.Username, user.Email, user.Password.hash, user.IsActive, DefaultRole).Scan(&user.ID, &user.CreatedAt)
+	return userConstraintError(err)
+}
+
+// CreateAndInvite creates an inactive user together with a hashed invitation
+// token that activates the account until it expires.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, tokenHash []byte, invitationExp time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO users (username, email, password, is_active) VALUES ($1, $2, $3, false) RETURNING id, created_at`
+		err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash).Scan(&user.ID, &user.CreatedAt)
+		if err != nil {
+			return userConstraintError(err)
+		}
+
+		query = `INSERT INTO user_roles (user_id, role) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(ctx, query, user.ID, DefaultRole); err != nil {
+			return err
+		}
+
+		query = `INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3)`
+		_, err = tx.ExecContext(ctx, query, tokenHash, user.ID, time.Now().Add(invitationExp))
+		return err
+	})
+}
+
+// Activate marks the user owning a valid invitation token as active and
+// removes their invitations.
+func (s *UserStore) Activate(ctx context.Context, tokenHash []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `
+		SELECT u.id FROM users u
+		JOIN user_invitations ui ON ui.user_id = u.id
+		WHERE ui.token = $1 AND ui.expiry > now()`
+
+		var userID int64
+		if err := tx.QueryRowContext(ctx, query, tokenHash).Scan(&userID); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET is_active = true WHERE id = $1`, userID); err != nil {
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM user_invitations WHERE user_id = $1`, userID)
+		return err
+	})
+}
+
+// GetMentionable returns the users among usernames that authorID can mention,
+// which leaves out accounts that aren't activated and the users who blocked
+// authorID.
+func (s *UserStore) GetMentionable(ctx context.Context, authorID int64, usernames []string) ([]*User, error) {
+	if len(usernames) == 0 {
+		return []*User{}, nil
+	}
+
+	query := `
+	SELECT u.id, u.username
+	FROM users u
+	WHERE u.username = ANY($1) AND u.is_active
+		AND NOT EXISTS (SELECT 1 FROM user_blocks b WHERE b.blocker_id = u.id AND b.blocked_id = $2)`
+
+	rows, err := s.db.Query(ctx, query, pq.Array(usernames), authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	query := `DELETE FROM users WHERE id = $1`
+	res, err := s.db.Exec(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
 }
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
-	query := `SELECT id, username, email, password, created_at FROM users WHERE id = $1`
+	query := `SELECT id, username, email, password, created_at, is_active, password_changed_at FROM users WHERE id = $1`
 	user := &User{}
-	err := s.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
+	err := s.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.IsActive, &user.PasswordChangedAt)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 	return user, nil
 }
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `SELECT id, username, email, password, created_at FROM users WHERE email = $1`
+	query := `SELECT id, username, email, password, created_at, is_active, password_changed_at FROM users WHERE email = $1`
 	user := &User{}
-	err := s.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt)
+	err := s.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password.hash, &user.CreatedAt, &user.IsActive, &user.PasswordChangedAt)
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
 	}
 	return user, nil
 }
+
+// CreatePasswordReset stores a hashed, single-use password reset token for the user.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, tokenHash []byte, exp time.Duration) error {
+	query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+	_, err := s.db.Exec(ctx, query, tokenHash, userID, time.Now().Add(exp))
+	return err
+}
+
+// ResetPassword consumes a valid reset token and sets the password of the user
+// it was issued for to user.Password. user.ID is filled in from the token.
+func (s *UserStore) ResetPassword(ctx context.Context, tokenHash []byte, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM password_resets WHERE token = $1 AND expiry > now() RETURNING user_id`
+		if err := tx.QueryRowContext(ctx, query, tokenHash).Scan(&user.ID); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		return updatePassword(ctx, tx, user)
+	})
+}
+
+// UpdatePassword sets a new password and revokes the user's outstanding tokens,
+// personal access tokens included, and sessions.
+func (s *UserStore) UpdatePassword(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeout)
+	defer cancel()
+
+	return s.db.WithTransaction(ctx, func(tx *sql.Tx) error {
+		return updatePassword(ctx, tx, user)
+	})
+}
+
+func updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1, password_changed_at = now() WHERE id = $2 RETURNING password_changed_at`
+	if err := tx.QueryRowContext(ctx, query, user.Password.hash, user.ID).Scan(&user.PasswordChangedAt); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrNotFound
+		default:
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM password_resets WHERE user_id = $1`, user.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, user.ID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`, user.ID); err != nil {
+		return err
+	}
+
+	// Personal access tokens were created by whoever knew the old password
+	_, err := tx.ExecContext(ctx, `DELETE FROM personal_access_tokens WHERE user_id = $1`, user.ID)
+	return err
+}
+
+// userConstraintError maps unique violations on users to their store errors.
+func userConstraintError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		switch pqErr.Constraint {
+		case "users_email_key":
+			return ErrDuplicateEmail
+		case "users_username_key":
+			return ErrDuplicateUsername
+		}
+	}
+	return err
+}